@@ -0,0 +1,200 @@
+// Command confcrypt encrypts,decrypts and rotates the secret values of a yaml configuration file.
+// The key is read from -key-file or the environment,see package config/secret.
+// Usage:
+//	confcrypt genkey
+//	confcrypt encrypt -value "password"
+//	confcrypt encrypt -file config.yaml -keys db.password,auth.private-key [-w]
+//	confcrypt decrypt -file config.yaml [-w]
+//	confcrypt rotate -file config.yaml -new-key-file new.key [-w]
+// Without -w the result is written to stdout.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/qeelyn/go-common/config/secret"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "genkey":
+		var key string
+		if key, err = secret.GenerateKey(); err == nil {
+			fmt.Println(key)
+		}
+	case "encrypt", "decrypt", "rotate":
+		err = run(os.Args[1], os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "confcrypt:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: confcrypt genkey|encrypt|decrypt|rotate [flags]")
+	os.Exit(2)
+}
+
+func run(cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	keyFile := fs.String("key-file", "", "file of the base64 key, default from $"+secret.EnvKey+" or $"+secret.EnvKeyFile)
+	file := fs.String("file", "", "yaml configuration file")
+	write := fs.Bool("w", false, "write result to the file instead of stdout")
+	value := fs.String("value", "", "encrypt a single value")
+	keys := fs.String("keys", "", "comma separated keys to encrypt, such as db.password")
+	newKeyFile := fs.String("new-key-file", "", "file of the new base64 key for rotate")
+	fs.Parse(args)
+
+	key, err := loadKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	if cmd == "encrypt" && *value != "" {
+		enc, err := secret.Encrypt(key, *value)
+		if err != nil {
+			return err
+		}
+		fmt.Println(enc)
+		return nil
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+	data, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "encrypt":
+		if *keys == "" {
+			return errors.New("-keys or -value is required")
+		}
+		for _, k := range strings.Split(*keys, ",") {
+			if err := encryptKey(doc, strings.TrimSpace(k), key); err != nil {
+				return err
+			}
+		}
+	case "decrypt":
+		if _, _, err := secret.Walk(doc, decryptFunc(key)); err != nil {
+			return err
+		}
+	case "rotate":
+		if *newKeyFile == "" {
+			return errors.New("-new-key-file is required")
+		}
+		newKey, err := secret.ReadKeyFile(*newKeyFile)
+		if err != nil {
+			return err
+		}
+		_, _, err = secret.Walk(doc, func(s string) (string, error) {
+			if !secret.IsEncrypted(s) {
+				return s, nil
+			}
+			plain, err := secret.Decrypt(key, s)
+			if err != nil {
+				return "", err
+			}
+			return secret.Encrypt(newKey, plain)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if *write {
+		info, err := os.Stat(*file)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(*file, out, info.Mode())
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func loadKey(keyFile string) ([]byte, error) {
+	if keyFile != "" {
+		return secret.ReadKeyFile(keyFile)
+	}
+	key, err := secret.KeyFromEnv()
+	if err == nil && key == nil {
+		err = fmt.Errorf("no key, use -key-file or set $%s", secret.EnvKey)
+	}
+	return key, err
+}
+
+func decryptFunc(key []byte) func(string) (string, error) {
+	return func(s string) (string, error) {
+		if !secret.IsEncrypted(s) {
+			return s, nil
+		}
+		return secret.Decrypt(key, s)
+	}
+}
+
+// encryptKey encrypts the value of the dotted key,all strings under a map or list are encrypted
+func encryptKey(doc yaml.MapSlice, key string, secretKey []byte) error {
+	path := strings.Split(key, ".")
+	cur := doc
+	for i, p := range path {
+		idx := -1
+		for j, item := range cur {
+			if k, ok := item.Key.(string); ok && strings.EqualFold(k, p) {
+				idx = j
+				break
+			}
+		}
+		if idx == -1 {
+			return fmt.Errorf("key %s not found", key)
+		}
+		if i < len(path)-1 {
+			sub, ok := cur[idx].Value.(yaml.MapSlice)
+			if !ok {
+				return fmt.Errorf("key %s not found", key)
+			}
+			cur = sub
+			continue
+		}
+		val := cur[idx].Value
+		if _, ok := val.(string); !ok {
+			if _, isMap := val.(yaml.MapSlice); !isMap {
+				if _, isList := val.([]interface{}); !isList {
+					// numbers and bools are encrypted as strings
+					val = fmt.Sprint(val)
+				}
+			}
+		}
+		r, _, err := secret.Walk(val, func(s string) (string, error) {
+			if secret.IsEncrypted(s) {
+				return s, nil
+			}
+			return secret.Encrypt(secretKey, s)
+		})
+		if err != nil {
+			return err
+		}
+		cur[idx].Value = r
+	}
+	return nil
+}
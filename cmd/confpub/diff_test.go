@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestDiffLines(t *testing.T) {
+	a := "appname: test\nappmode: debug\nlisten: \":8000\"\n"
+	b := "appname: test\nappmode: release\nlisten: \":8000\"\nweb: public\n"
+	want := " appname: test\n-appmode: debug\n+appmode: release\n listen: \":8000\"\n+web: public\n"
+	if d := diffLines(a, b); d != want {
+		t.Errorf("diff:\n%s", d)
+	}
+	if d := diffLines("", "a\n"); d != "+a\n" {
+		t.Errorf("diff:\n%s", d)
+	}
+}
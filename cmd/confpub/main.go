@@ -0,0 +1,228 @@
+// Command confpub publishes a local configuration file to etcd for LoadRemoteConfig,
+// keeps the numbered history of revisions and rolls back to a chosen one.
+// Usage:
+//	confpub validate -dsn 127.0.0.1:2379 -path go-common -file config.yaml [-require db.dsn,listen]
+//	confpub push -dsn 127.0.0.1:2379 -path go-common -file config.yaml -m "message"
+//	confpub get -dsn 127.0.0.1:2379 -path go-common -name config.yaml [-version 3]
+//	confpub history -dsn 127.0.0.1:2379 -path go-common -name config.yaml
+//	confpub diff -dsn 127.0.0.1:2379 -path go-common -name config.yaml -from 2 [-to 3]
+//	confpub rollback -dsn 127.0.0.1:2379 -path go-common -name config.yaml -to 2
+// The dsn has the same format as the etcdv3 registry,-to of diff defaults to the current content.
+// The file is validated before pushing as LoadRemoteConfig loads it:the includes must exist in etcd,
+// the references must be resolved,the encrypted values must be decrypted by the key of -secret-key-file
+// or the environment,and the keys of -require must be set.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/etcdv3"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	retcd "github.com/qeelyn/go-common/grpcx/registry/etcdv3"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	dsn := fs.String("dsn", "127.0.0.1:2379", "etcd dsn, such as 127.0.0.1:2379?username=u&password=p")
+	dir := fs.String("path", "", "remote path of the configuration, the same as options.Path")
+	name := fs.String("name", "", "remote file name, default is the base name of -file")
+	file := fs.String("file", "", "local configuration file to push")
+	message := fs.String("m", "", "message of the revision")
+	version := fs.Int64("version", 0, "version to get, 0 means the current")
+	from := fs.Int64("from", 0, "version to diff from")
+	to := fs.Int64("to", 0, "version to diff to or roll back to")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of the operation")
+	require := fs.String("require", "", "comma separated keys which must be set")
+	secretKeyFile := fs.String("secret-key-file", "", "file of the key to decrypt the ENC[...] values")
+	fs.Parse(os.Args[2:])
+
+	if *name == "" && *file != "" {
+		*name = filepath.Base(*file)
+	}
+	if *dir == "" || *name == "" {
+		fail(errors.New("-path and -name (or -file) are required"))
+	}
+	r, err := retcd.NewRegistry(registry.Dsn(*dsn))
+	if err != nil {
+		fail(err)
+	}
+	client := r.GetClient().(*clientv3.Client)
+	defer client.Close()
+	pub := etcdv3.NewPublisher(client, path.Clean(*dir)+"/"+*name)
+	opts := config.ParseOptions(config.Path(path.Clean(*dir)), config.FileName(*name), config.Registry(r),
+		config.SecretKeyFile(*secretKeyFile))
+	remote, err := etcdv3.NewEtcdConfigProvider(opts)
+	if err != nil {
+		fail(err)
+	}
+	v := &validator{remote: remote, opts: opts, required: splitKeys(*require)}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch cmd {
+	case "validate":
+		err = validateFile(v, *file)
+	case "push":
+		err = push(ctx, pub, v, *file, *message)
+	case "get":
+		err = get(ctx, pub, *version)
+	case "history":
+		err = history(ctx, pub)
+	case "diff":
+		err = diff(ctx, pub, *from, *to)
+	case "rollback":
+		err = rollback(ctx, pub, *to)
+	default:
+		usage()
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: confpub validate|push|get|history|diff|rollback [flags]")
+	os.Exit(2)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "confpub:", err)
+	os.Exit(1)
+}
+
+// validator validates the content before publishing
+type validator struct {
+	remote   remoteProvider
+	opts     *options.Options
+	required []string
+}
+
+func splitKeys(s string) []string {
+	var keys []string
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// readValid reads the file and validates it
+func (t *validator) readValid(file string) ([]byte, error) {
+	if file == "" {
+		return nil, errors.New("-file is required")
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(t.remote, t.opts, content, t.required); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return content, nil
+}
+
+func validateFile(v *validator, file string) error {
+	if _, err := v.readValid(file); err != nil {
+		return err
+	}
+	fmt.Println("ok")
+	return nil
+}
+
+func push(ctx context.Context, pub *etcdv3.Publisher, v *validator, file, message string) error {
+	content, err := v.readValid(file)
+	if err != nil {
+		return err
+	}
+	rev, err := pub.Publish(ctx, content, message)
+	if err == etcdv3.ErrNotChanged {
+		fmt.Println("not changed")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("published version %d\n", rev.Version)
+	return nil
+}
+
+func get(ctx context.Context, pub *etcdv3.Publisher, version int64) error {
+	content, err := contentOf(ctx, pub, version)
+	if err != nil {
+		return err
+	}
+	fmt.Print(content)
+	return nil
+}
+
+func history(ctx context.Context, pub *etcdv3.Publisher) error {
+	revs, err := pub.History(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rev := range revs {
+		fmt.Printf("%d\t%s\t%s\n", rev.Version, rev.Time.Format(time.RFC3339), rev.Message)
+	}
+	return nil
+}
+
+func diff(ctx context.Context, pub *etcdv3.Publisher, from, to int64) error {
+	if from == 0 {
+		return errors.New("-from is required")
+	}
+	a, err := contentOf(ctx, pub, from)
+	if err != nil {
+		return err
+	}
+	b, err := contentOf(ctx, pub, to)
+	if err != nil {
+		return err
+	}
+	fmt.Print(diffLines(a, b))
+	return nil
+}
+
+func rollback(ctx context.Context, pub *etcdv3.Publisher, to int64) error {
+	if to == 0 {
+		return errors.New("-to is required")
+	}
+	rev, err := pub.Rollback(ctx, to)
+	if err == etcdv3.ErrNotChanged {
+		fmt.Println("not changed")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rolled back to %d as version %d\n", to, rev.Version)
+	return nil
+}
+
+// contentOf returns the content of version,0 means the current
+func contentOf(ctx context.Context, pub *etcdv3.Publisher, version int64) (string, error) {
+	if version == 0 {
+		content, err := pub.Current(ctx)
+		return string(content), err
+	}
+	rev, err := pub.Revision(ctx, version)
+	if err != nil {
+		return "", err
+	}
+	return rev.Content, nil
+}
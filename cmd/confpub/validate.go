@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+	"io"
+)
+
+// remoteProvider is the remote config provider,List is required by the remote globs
+type remoteProvider interface {
+	config.RemoteProvider
+	List(prefix string) ([]string, error)
+}
+
+// pendingProvider serves the content to publish at key,the other keys such as the includes are read from remote
+type pendingProvider struct {
+	remoteProvider
+	key     string
+	content []byte
+}
+
+func (t pendingProvider) Get(rp viper.RemoteProvider) (io.Reader, error) {
+	if rp.Path() == t.key {
+		return bytes.NewReader(t.content), nil
+	}
+	return t.remoteProvider.Get(rp)
+}
+
+func (t pendingProvider) Watch(rp viper.RemoteProvider) (io.Reader, error) {
+	return t.Get(rp)
+}
+
+// validate loads content as LoadRemoteConfig would load it from the key of opts after publishing:
+// the includes are read from remote,the references are resolved,the encrypted values are decrypted,
+// and the required keys must be set.
+func validate(remote remoteProvider, opts *options.Options, content []byte, required []string) error {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(content, &m); err != nil {
+		return fmt.Errorf("invalid yaml: %s", err)
+	}
+	if len(m) == 0 {
+		return errors.New("configuration is empty")
+	}
+	key := opts.Path + "/" + opts.FileName
+	name := opts.Provider
+	if name == "" {
+		name = config.DefaultProvider
+	}
+	config.RegisterProvider(name, pendingProvider{remoteProvider: remote, key: key, content: content})
+	defer config.RegisterProvider(name, remote)
+	cnf, err := config.LoadRemoteConfig(opts)
+	if err != nil {
+		return err
+	}
+	for _, k := range required {
+		if !cnf.IsSet(k) {
+			return fmt.Errorf("required key %s is not set", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"github.com/qeelyn/go-common/config"
+	"github.com/spf13/viper"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// memoryProvider is a remote provider of the published keys
+type memoryProvider map[string]string
+
+func (t memoryProvider) Get(rp viper.RemoteProvider) (io.Reader, error) {
+	v, ok := t[rp.Path()]
+	if !ok {
+		return nil, &config.NotFoundError{Key: rp.Path()}
+	}
+	return bytes.NewReader([]byte(v)), nil
+}
+
+func (t memoryProvider) Watch(rp viper.RemoteProvider) (io.Reader, error) {
+	return t.Get(rp)
+}
+
+func (t memoryProvider) WatchChannel(rp viper.RemoteProvider) (<-chan *viper.RemoteResponse, chan bool) {
+	return nil, make(chan bool)
+}
+
+func (t memoryProvider) List(prefix string) ([]string, error) {
+	var keys []string
+	for k := range t {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func TestValidate(t *testing.T) {
+	remote := memoryProvider{
+		"app/config.yaml": "appname: old\n",
+		"app/db.yaml":     "dsn: root@/app\n",
+	}
+	opts := config.ParseOptions(config.Path("app"), config.FileName("config.yaml"), config.Provider("etcd"))
+	valid := "appname: app\ndb:\n  $include: db.yaml\nlisten: ${LISTEN_ADDR::8000}\nweb: ${listen}\n"
+	if err := validate(remote, opts, []byte(valid), []string{"db.dsn", "web"}); err != nil {
+		t.Fatal(err)
+	}
+	for content, msg := range map[string]string{
+		"appname: [":                          "invalid yaml",
+		"":                                    "configuration is empty",
+		"db:\n  $include: missing.yaml\n":     "missing.yaml",
+		"web: ${listen}\n":                    "listen",
+		"password: ENC[AES256_GCM,data:xxx]\n": "secret",
+	} {
+		err := validate(remote, opts, []byte(content), nil)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%q: expect error with %q, got %v", content, msg, err)
+		}
+	}
+	if err := validate(remote, opts, []byte(valid), []string{"db.user"}); err == nil {
+		t.Error("required key is not checked")
+	}
+	// the remote provider is restored
+	cnf, err := config.LoadRemoteConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.GetString("appname") != "old" {
+		t.Error("remote provider must be restored")
+	}
+}
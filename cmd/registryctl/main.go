@@ -0,0 +1,230 @@
+// Command registryctl lists,watches and manages the nodes of the etcdv3 registry.
+// Usage:
+//	registryctl list -dsn 127.0.0.1:2379 [-service user]
+//	registryctl watch -dsn 127.0.0.1:2379 [-service user]
+//	registryctl drain -dsn 127.0.0.1:2379 -service user -id user-1
+//	registryctl undrain -dsn 127.0.0.1:2379 -service user -id user-1
+//	registryctl remove -dsn 127.0.0.1:2379 -service user -id user-1
+// The dsn has the same format as the etcdv3 registry. A drained node is kept in the registry but not resolved
+// by the clients until it is undrained or registers again. A removed node may register again if its process
+// is still running.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	retcd "github.com/qeelyn/go-common/grpcx/registry/etcdv3"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	dsn := fs.String("dsn", "127.0.0.1:2379", "etcd dsn, such as 127.0.0.1:2379?username=u&password=p")
+	service := fs.String("service", "", "service name, all services if it is empty for list and watch")
+	id := fs.String("id", "", "node id")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of the operation except watch")
+	fs.Parse(os.Args[2:])
+
+	r, err := retcd.NewRegistry(registry.Dsn(*dsn))
+	if err != nil {
+		fail(err)
+	}
+	client := r.GetClient().(*clientv3.Client)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch cmd {
+	case "list":
+		err = list(ctx, client, *service)
+	case "watch":
+		err = watch(context.Background(), client, *service)
+	case "drain", "undrain", "remove":
+		if *service == "" || *id == "" {
+			fail(errors.New("-service and -id are required"))
+		}
+		key := retcd.NodePath(*service, *id)
+		if cmd == "remove" {
+			err = remove(ctx, client, key)
+		} else {
+			err = drain(ctx, client, key, cmd == "drain")
+		}
+	default:
+		usage()
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: registryctl list|watch|drain|undrain|remove [flags]")
+	os.Exit(2)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "registryctl:", err)
+	os.Exit(1)
+}
+
+// prefix returns the key prefix of the service,or all services
+func prefix(service string) string {
+	if service == "" {
+		return retcd.SCHEMA + "/"
+	}
+	return retcd.ServicePath(service) + "/"
+}
+
+// serviceOf returns the service name of the node key
+func serviceOf(key string) string {
+	return path.Base(path.Dir(key))
+}
+
+func list(ctx context.Context, client *clientv3.Client, service string) error {
+	resp, err := client.Get(ctx, prefix(service), clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tID\tADDRESS\tTTL\tMETADATA")
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		node, err := registry.DecodeNode(path.Base(key), kv.Value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid node %s: %s\n", key, err)
+			continue
+		}
+		ttl := "-"
+		if kv.Lease != 0 {
+			if lr, err := client.TimeToLive(ctx, clientv3.LeaseID(kv.Lease)); err == nil {
+				ttl = formatTTL(lr.TTL, lr.GrantedTTL)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", serviceOf(key), node.Id, node.Address, ttl, formatMetadata(node.Metadata))
+	}
+	return w.Flush()
+}
+
+func watch(ctx context.Context, client *clientv3.Client, service string) error {
+	for resp := range client.Watch(ctx, prefix(service), clientv3.WithPrefix(), clientv3.WithPrevKV()) {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range resp.Events {
+			key := string(ev.Kv.Key)
+			typ, value := registry.EventUpdate, ev.Kv.Value
+			switch {
+			case ev.Type == clientv3.EventTypeDelete:
+				typ, value = registry.EventDelete, nil
+				if ev.PrevKv != nil {
+					value = ev.PrevKv.Value
+				}
+			case ev.IsCreate():
+				typ = registry.EventCreate
+			}
+			node, err := registry.DecodeNode(path.Base(key), value)
+			if err != nil {
+				node = &registry.Node{Id: path.Base(key)}
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), typ, serviceOf(key),
+				node.Id, node.Address, formatMetadata(node.Metadata))
+		}
+	}
+	return nil
+}
+
+// drain marks the node as drained or serving,the lease of the node is kept
+func drain(ctx context.Context, client *clientv3.Client, key string, drained bool) error {
+	resp, err := client.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return fmt.Errorf("node %s is not found", key)
+	}
+	kv := resp.Kvs[0]
+	node, err := registry.DecodeNode(path.Base(key), kv.Value)
+	if err != nil {
+		return err
+	}
+	setDrained(node, drained)
+	value, err := registry.EncodeNode(node)
+	if err != nil {
+		return err
+	}
+	var opts []clientv3.OpOption
+	if kv.Lease != 0 {
+		opts = append(opts, clientv3.WithLease(clientv3.LeaseID(kv.Lease)))
+	}
+	// the node is not changed if it is registered again after the get
+	txn, err := client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+		Then(clientv3.OpPut(key, string(value), opts...)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return fmt.Errorf("node %s is changed, try again", key)
+	}
+	fmt.Printf("%s: drained=%t\n", key, drained)
+	return nil
+}
+
+func remove(ctx context.Context, client *clientv3.Client, key string) error {
+	resp, err := client.Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return fmt.Errorf("node %s is not found", key)
+	}
+	fmt.Printf("%s: removed\n", key)
+	return nil
+}
+
+// setDrained sets or clears the drained metadata
+func setDrained(node *registry.Node, drained bool) {
+	if !drained {
+		delete(node.Metadata, registry.MetadataDrained)
+		return
+	}
+	if node.Metadata == nil {
+		node.Metadata = make(map[string]string)
+	}
+	node.Metadata[registry.MetadataDrained] = "true"
+}
+
+// formatTTL shows the remaining and granted ttl of the lease,such as 7s/10s
+func formatTTL(ttl, granted int64) string {
+	if ttl < 0 {
+		return "expired"
+	}
+	return fmt.Sprintf("%ds/%ds", ttl, granted)
+}
+
+// formatMetadata shows the metadata as sorted k=v pairs
+func formatMetadata(md map[string]string) string {
+	if len(md) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(md))
+	for k, v := range md {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
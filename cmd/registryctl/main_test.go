@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	retcd "github.com/qeelyn/go-common/grpcx/registry/etcdv3"
+	"testing"
+	"time"
+)
+
+func TestFormatMetadata(t *testing.T) {
+	if s := formatMetadata(nil); s != "-" {
+		t.Errorf("empty metadata: %s", s)
+	}
+	if s := formatMetadata(map[string]string{"zone": "a", "version": "v1"}); s != "version=v1,zone=a" {
+		t.Errorf("metadata: %s", s)
+	}
+}
+
+func TestSetDrained(t *testing.T) {
+	node := &registry.Node{Id: "n1", Address: ":9000"}
+	setDrained(node, true)
+	if !node.Drained() {
+		t.Error("node must be drained")
+	}
+	setDrained(node, false)
+	if node.Drained() {
+		t.Error("node must be serving")
+	}
+	if s := serviceOf("qeelyn/user/n1"); s != "user" {
+		t.Errorf("service: %s", s)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	r, err := retcd.NewRegistry(registry.Dsn("127.0.0.1:2379"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := r.GetClient().(*clientv3.Client)
+	service := fmt.Sprintf("registryctl-test-%d", time.Now().UnixNano())
+	node := &registry.Node{Id: "n1", Address: "10.0.0.1:9000", Metadata: map[string]string{registry.MetadataVersion: "v1"}}
+	if err := r.Register(service, node); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Unregister(service, node)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	key := retcd.NodePath(service, node.Id)
+	get := func() (*registry.Node, int64) {
+		resp, err := client.Get(ctx, key)
+		if err != nil || len(resp.Kvs) == 0 {
+			t.Fatalf("get %s: %v", key, err)
+		}
+		n, err := registry.DecodeNode(node.Id, resp.Kvs[0].Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n, resp.Kvs[0].Lease
+	}
+	_, lease := get()
+
+	if err := drain(ctx, client, key, true); err != nil {
+		t.Fatal(err)
+	}
+	n, l := get()
+	if !n.Drained() || n.Metadata[registry.MetadataVersion] != "v1" {
+		t.Errorf("drained node: %+v", n)
+	}
+	if l != lease {
+		t.Error("the lease of the node must be kept")
+	}
+	if nodes, _ := r.GetService(service); len(nodes) != 1 || !nodes[0].Drained() {
+		t.Errorf("nodes: %v", nodes)
+	}
+	if err := drain(ctx, client, key, false); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := get(); n.Drained() {
+		t.Error("node must be undrained")
+	}
+	if err := drain(ctx, client, retcd.NodePath(service, "absent"), true); err == nil {
+		t.Error("drain of the absent node must fail")
+	}
+}
@@ -0,0 +1,341 @@
+package config
+
+import (
+	"fmt"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// FieldError describes an invalid configuration key
+type FieldError struct {
+	Key    string
+	Reason string
+}
+
+func (t *FieldError) Error() string {
+	return t.Key + ": " + t.Reason
+}
+
+// BindError aggregates all invalid keys found by Bind
+type BindError struct {
+	Errors []*FieldError
+}
+
+func (t *BindError) Error() string {
+	msgs := make([]string, len(t.Errors))
+	for i, e := range t.Errors {
+		msgs[i] = e.Error()
+	}
+	return "config: invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+// Bind populates the struct pointed by out from the key of cnf,an empty key binds the whole configuration.
+// The key of a field is the `mapstructure` tag or the lower case field name.
+// Supported tags:
+//	default:"10s"                    used when the key is not set,slices are separated by comma
+//	validate:"required,min=1,max=5"  min and max compare the value of numbers and durations,the length of strings,slices and maps
+//	validate:"oneof=debug prod test" the value must be one of the space separated list
+// All invalid keys are returned together as *BindError.
+// Example:
+//	type LogConfig struct {
+//		Filename string        `mapstructure:"filename" validate:"required"`
+//		MaxSize  int           `mapstructure:"maxsize" default:"100" validate:"min=1"`
+//		Flush    time.Duration `mapstructure:"flush" default:"1s"`
+//	}
+//	var lc LogConfig
+//	err := config.Bind(cnf, "log.file", &lc)
+func Bind(cnf *viper.Viper, key string, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Bind needs a pointer to struct, got %T", out)
+	}
+	b := &binder{}
+	lookup := func(k string) (interface{}, bool) {
+		if !cnf.IsSet(k) {
+			return nil, false
+		}
+		return cnf.Get(k), true
+	}
+	b.bindStruct(rv.Elem(), strings.ToLower(key), lookup)
+	if len(b.errs) > 0 {
+		return &BindError{Errors: b.errs}
+	}
+	return nil
+}
+
+type binder struct {
+	errs []*FieldError
+}
+
+func (t *binder) fail(key string, format string, args ...interface{}) {
+	t.errs = append(t.errs, &FieldError{Key: key, Reason: fmt.Sprintf(format, args...)})
+}
+
+// lookup gets the raw value by the full dotted key
+type lookupFunc func(key string) (interface{}, bool)
+
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func fieldKey(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+	return strings.ToLower(name)
+}
+
+func (t *binder) bindStruct(rv reflect.Value, prefix string, lookup lookupFunc) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("mapstructure") == "-" {
+			continue
+		}
+		key := joinKey(prefix, fieldKey(f))
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			t.bindStruct(fv, key, lookup)
+			continue
+		}
+		raw, ok := lookup(key)
+		def, hasDefault := f.Tag.Lookup("default")
+		if !ok && hasDefault {
+			raw, ok = def, true
+			if fv.Kind() == reflect.Slice {
+				raw = splitDefault(def)
+			}
+		}
+		if ok && raw != nil {
+			if err := t.assign(fv, key, raw); err != nil {
+				t.fail(key, "%s", err)
+				continue
+			}
+		}
+		t.validate(fv, key, f.Tag.Get("validate"), ok)
+	}
+}
+
+func splitDefault(def string) []interface{} {
+	if def == "" {
+		return nil
+	}
+	parts := strings.Split(def, ",")
+	val := make([]interface{}, len(parts))
+	for i, p := range parts {
+		val[i] = strings.TrimSpace(p)
+	}
+	return val
+}
+
+// assign converts raw to the type of fv,the errors of nested elements are recorded by the element key
+func (t *binder) assign(fv reflect.Value, key string, raw interface{}) error {
+	if fv.Type() == durationType {
+		d, err := cast.ToDurationE(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %v", raw)
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.Ptr:
+		v := reflect.New(fv.Type().Elem())
+		if v.Elem().Kind() == reflect.Struct {
+			m, err := cast.ToStringMapE(raw)
+			if err != nil {
+				return fmt.Errorf("expect a map, got %T", raw)
+			}
+			t.bindStruct(v.Elem(), key, mapLookup(key, m))
+		} else if err := t.assign(v.Elem(), key, raw); err != nil {
+			return err
+		}
+		fv.Set(v)
+	case reflect.Struct:
+		m, err := cast.ToStringMapE(raw)
+		if err != nil {
+			return fmt.Errorf("expect a map, got %T", raw)
+		}
+		t.bindStruct(fv, key, mapLookup(key, m))
+	case reflect.Slice:
+		if s, ok := raw.(string); ok {
+			raw = splitDefault(s)
+		}
+		items, err := cast.ToSliceE(raw)
+		if err != nil {
+			rs := reflect.ValueOf(raw)
+			if rs.Kind() != reflect.Slice {
+				return fmt.Errorf("expect a list, got %T", raw)
+			}
+			items = make([]interface{}, rs.Len())
+			for i := range items {
+				items[i] = rs.Index(i).Interface()
+			}
+		}
+		sv := reflect.MakeSlice(fv.Type(), len(items), len(items))
+		for i, item := range items {
+			ik := key + "." + strconv.Itoa(i)
+			if err := t.assign(sv.Index(i), ik, item); err != nil {
+				t.fail(ik, "%s", err)
+			}
+		}
+		fv.Set(sv)
+	case reflect.Map:
+		if fv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", fv.Type().Key())
+		}
+		m, err := cast.ToStringMapE(raw)
+		if err != nil {
+			return fmt.Errorf("expect a map, got %T", raw)
+		}
+		mv := reflect.MakeMap(fv.Type())
+		for k, item := range m {
+			ik := key + "." + k
+			ev := reflect.New(fv.Type().Elem()).Elem()
+			if err := t.assign(ev, ik, item); err != nil {
+				t.fail(ik, "%s", err)
+				continue
+			}
+			mv.SetMapIndex(reflect.ValueOf(k).Convert(fv.Type().Key()), ev)
+		}
+		fv.Set(mv)
+	case reflect.Interface:
+		fv.Set(reflect.ValueOf(raw))
+	default:
+		v, err := castScalar(fv.Kind(), raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s %v", fv.Kind(), raw)
+		}
+		fv.Set(reflect.ValueOf(v).Convert(fv.Type()))
+	}
+	return nil
+}
+
+func castScalar(kind reflect.Kind, raw interface{}) (interface{}, error) {
+	switch kind {
+	case reflect.String:
+		return cast.ToStringE(raw)
+	case reflect.Bool:
+		return cast.ToBoolE(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cast.ToInt64E(raw)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cast.ToUint64E(raw)
+	case reflect.Float32, reflect.Float64:
+		return cast.ToFloat64E(raw)
+	}
+	return nil, fmt.Errorf("unsupported type %s", kind)
+}
+
+// mapLookup looks up the keys under prefix from m,the keys of nested maps are case insensitive
+func mapLookup(prefix string, m map[string]interface{}) lookupFunc {
+	return func(key string) (interface{}, bool) {
+		path := strings.Split(strings.TrimPrefix(key, prefix+"."), ".")
+		var cur interface{} = m
+		for _, p := range path {
+			cm, err := cast.ToStringMapE(cur)
+			if err != nil {
+				return nil, false
+			}
+			found := false
+			for k, v := range cm {
+				if strings.EqualFold(k, p) {
+					cur, found = v, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		}
+		return cur, true
+	}
+}
+
+func (t *binder) validate(fv reflect.Value, key, rules string, set bool) {
+	if rules == "" {
+		return
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i != -1 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required":
+			if !set || isZero(fv) {
+				t.fail(key, "is required")
+				return
+			}
+		case "min", "max":
+			if !set && isZero(fv) {
+				continue
+			}
+			n, limit, err := measure(fv, arg)
+			if err != nil {
+				t.fail(key, "invalid rule %s: %s", rule, err)
+				continue
+			}
+			if name == "min" && n < limit {
+				t.fail(key, "must be at least %s", arg)
+			} else if name == "max" && n > limit {
+				t.fail(key, "must be at most %s", arg)
+			}
+		case "oneof":
+			val := fmt.Sprint(fv.Interface())
+			ok := false
+			for _, o := range strings.Fields(arg) {
+				if o == val {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				t.fail(key, "must be one of [%s]", arg)
+			}
+		default:
+			t.fail(key, "unknown validate rule %s", name)
+		}
+	}
+}
+
+// measure returns the comparable value of fv and the parsed limit
+func measure(fv reflect.Value, arg string) (float64, float64, error) {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(arg)
+		return float64(fv.Int()), float64(d), err
+	}
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch fv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(fv.Len()), limit, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), limit, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), limit, nil
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), limit, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported type %s", fv.Type())
+}
+
+func isZero(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return fv.Len() == 0
+	}
+	return reflect.DeepEqual(fv.Interface(), reflect.Zero(fv.Type()).Interface())
+}
@@ -0,0 +1,118 @@
+package config_test
+
+import (
+	"bytes"
+	"github.com/qeelyn/go-common/config"
+	"github.com/spf13/viper"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testLogFile struct {
+	Filename string `mapstructure:"filename" validate:"required"`
+	MaxSize  int    `mapstructure:"maxsize" default:"100" validate:"min=1,max=1024"`
+	Level    int    `mapstructure:"level" validate:"min=-1,max=5"`
+}
+
+type testServer struct {
+	Name    string        `mapstructure:"appname" validate:"required"`
+	Mode    string        `mapstructure:"appmode" default:"debug" validate:"oneof=debug prod test"`
+	Timeout time.Duration `mapstructure:"timeout" default:"3s" validate:"min=1s"`
+	Hosts   []string      `mapstructure:"hosts" default:"a,b"`
+	Log     struct {
+		File testLogFile `mapstructure:"file"`
+	} `mapstructure:"log"`
+	Backends []struct {
+		Addr   string `mapstructure:"addr" validate:"required"`
+		Weight int    `mapstructure:"weight" default:"1"`
+	} `mapstructure:"backends"`
+	Labels map[string]string `mapstructure:"labels"`
+}
+
+func newTestViper(t *testing.T, yaml string) *viper.Viper {
+	cnf := viper.New()
+	cnf.SetConfigType("yaml")
+	if err := cnf.ReadConfig(bytes.NewBufferString(yaml)); err != nil {
+		t.Fatal(err)
+	}
+	return cnf
+}
+
+func TestBind(t *testing.T) {
+	cnf := newTestViper(t, `
+appname: test
+timeout: 5s
+log:
+  file:
+    filename: "runtime/api.log"
+    level: -1
+backends:
+  - addr: 127.0.0.1:80
+    weight: 2
+  - addr: 127.0.0.1:81
+labels:
+  zone: a
+`)
+	var s testServer
+	if err := config.Bind(cnf, "", &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "test" || s.Mode != "debug" || s.Timeout != 5*time.Second {
+		t.Errorf("bind scalar error:%+v", s)
+	}
+	if len(s.Hosts) != 2 || s.Hosts[1] != "b" {
+		t.Errorf("bind default slice error:%v", s.Hosts)
+	}
+	if s.Log.File.Filename != "runtime/api.log" || s.Log.File.MaxSize != 100 || s.Log.File.Level != -1 {
+		t.Errorf("bind nested struct error:%+v", s.Log.File)
+	}
+	if len(s.Backends) != 2 || s.Backends[0].Weight != 2 || s.Backends[1].Weight != 1 {
+		t.Errorf("bind struct slice error:%+v", s.Backends)
+	}
+	if s.Labels["zone"] != "a" {
+		t.Errorf("bind map error:%v", s.Labels)
+	}
+
+	var lf testLogFile
+	if err := config.Bind(cnf, "log.file", &lf); err != nil {
+		t.Fatal(err)
+	}
+	if lf.Filename != "runtime/api.log" {
+		t.Error("bind sub key error")
+	}
+}
+
+func TestBindError(t *testing.T) {
+	cnf := newTestViper(t, `
+appmode: release
+timeout: 1ms
+log:
+  file:
+    maxsize: 0
+    level: abc
+backends:
+  - weight: 2
+`)
+	var s testServer
+	err := config.Bind(cnf, "", &s)
+	be, ok := err.(*config.BindError)
+	if !ok {
+		t.Fatalf("expect BindError, got %v", err)
+	}
+	want := []string{"appname", "appmode", "timeout", "log.file.filename", "log.file.maxsize", "log.file.level", "backends.0.addr"}
+	if len(be.Errors) != len(want) {
+		t.Fatalf("errors:%s", err)
+	}
+	for i, k := range want {
+		if be.Errors[i].Key != k {
+			t.Errorf("expect %s, got %s", k, be.Errors[i].Key)
+		}
+	}
+	if !strings.Contains(err.Error(), "log.file.filename: is required") {
+		t.Error(err)
+	}
+	if err := config.Bind(cnf, "", s); err == nil {
+		t.Error("must need a pointer")
+	}
+}
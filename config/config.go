@@ -12,6 +12,8 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 func Path(p string) options.Option {
@@ -32,6 +34,35 @@ func Registry(r registry.Registry) options.Option {
 	}
 }
 
+// Provider sets the name of the remote provider such as etcd,consul or http,
+// the provider must be built by its package before loading.
+func Provider(name string) options.Option {
+	return func(o *options.Options) {
+		o.Provider = name
+	}
+}
+
+// Addr sets the address of the remote provider
+func Addr(addr string) options.Option {
+	return func(o *options.Options) {
+		o.Addr = addr
+	}
+}
+
+// WatchDebounce sets how long Watch waits for sources to settle before reloading
+func WatchDebounce(d time.Duration) options.Option {
+	return func(o *options.Options) {
+		o.WatchDebounce = d
+	}
+}
+
+// ConfDir sets the directory of fragments,a relative path is based on the directory of the config file
+func ConfDir(dir string) options.Option {
+	return func(o *options.Options) {
+		o.ConfDir = dir
+	}
+}
+
 func ParseOptions(opts ...options.Option) *options.Options {
 	opt := &options.Options{}
 	for _, o := range opts {
@@ -40,14 +71,79 @@ func ParseOptions(opts ...options.Option) *options.Options {
 	return opt
 }
 
-// if use remote must set NewRemoteFunc
+// if use remote must set NewRemoteFunc,the configuration is remote if Registry or Provider is set.
+// After all layers are merged,the references ${ENV_VAR:default} and ${other.key} in values are resolved.
+// Example:
+//	registry:
+//	  host: ${REGISTRY_HOST:127.0.0.1}
+//	  dsn: ${registry.host}:2379
 func LoadConfig(opts *options.Options) (*viper.Viper, error) {
-	if opts.Registry != nil {
+	if opts.Registry != nil || opts.Provider != "" {
 		return LoadRemoteConfig(opts)
 	}
 	return LoadLocalConfig(opts)
 }
 
+// source records how a configuration was loaded,so that it can be reloaded by Watch
+type source struct {
+	opts   *options.Options
+	remote bool
+	// local files and directories which make up the configuration
+	files []string
+	dirs  []string
+	// applied layers in order
+	layers []Layer
+	// the source of each key and the keys of encrypted values
+	origins map[string]string
+	secrets map[string]bool
+	// the saved time of the snapshot if the remote is unreachable
+	stale time.Time
+}
+
+// the sources of the loaded configurations,the entry is kept until Release
+var (
+	sourcesMu sync.Mutex
+	sources   = make(map[*viper.Viper]*source)
+)
+
+func lookupSource(cnf *viper.Viper) (*source, bool) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	src, ok := sources[cnf]
+	return src, ok
+}
+
+func storeSource(cnf *viper.Viper, src *source) {
+	sourcesMu.Lock()
+	sources[cnf] = src
+	sourcesMu.Unlock()
+}
+
+func deleteSource(cnf *viper.Viper) {
+	sourcesMu.Lock()
+	delete(sources, cnf)
+	sourcesMu.Unlock()
+}
+
+// Release closes the watcher of cnf and forgets its sources,Layers,Explain and Watch are not available for it after.
+// The configurations loaded once for the lifetime of the process need not be released.
+func Release(cnf *viper.Viper) {
+	watchersMu.Lock()
+	w, ok := watchers[cnf]
+	watchersMu.Unlock()
+	if ok {
+		w.Close()
+	}
+	deleteSource(cnf)
+}
+
+func (t *source) load() (*viper.Viper, *source, error) {
+	if t.remote {
+		return loadRemoteConfig(t.opts)
+	}
+	return loadLocalConfig(t.opts)
+}
+
 // LoadLocalConfig loads configuration from the given list of paths and populates it into the Config variable.
 // The configuration file(s) should be named as app.yaml.
 // Example (Use App Model):
@@ -55,12 +151,22 @@ func LoadConfig(opts *options.Options) (*viper.Viper, error) {
 //  // appmode has three mode: debug,prod,test,use it in your project
 //  evn := app.GetString("appmode")
 func LoadLocalConfig(opts *options.Options) (*viper.Viper, error) {
+	cnf, src, err := loadLocalConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	storeSource(cnf, src)
+	return cnf, nil
+}
+
+func loadLocalConfig(opts *options.Options) (*viper.Viper, *source, error) {
+	applyConfigFlag(opts)
 	//var filename, ext string = "app", "yaml"
 	configFile := path.Join(opts.Path, opts.FileName)
 	realPath, _ := filepath.Abs(configFile)
 	file, err := os.Stat(realPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	configPath := path.Dir(filepath.ToSlash(realPath))
 	fn := strings.Split(file.Name(), ".")
@@ -70,38 +176,127 @@ func LoadLocalConfig(opts *options.Options) (*viper.Viper, error) {
 	//cnf.WatchConfig()
 	cnf.SetConfigName(filename)
 	cnf.SetConfigType(ext)
-	cnf.AutomaticEnv()
+	// the upper case keys in the environment override without EnvPrefix or EnvKeys,such as APPMODE
+	if !envEnabled(opts) {
+		cnf.AutomaticEnv()
+	}
 
 	cnf.AddConfigPath(configPath)
 	cnf.SetDefault("debug", false)
 
 	if err := cnf.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("Failed to read the configuration file: %s", err)
+		return nil, nil, fmt.Errorf("Failed to read the configuration file: %s", err)
 	}
-	// local
-	localConfig := path.Join(configPath, filename+"-local."+ext)
-	if _, err := os.Stat(localConfig); err == nil {
-		cnf.SetConfigName(filename + "-local")
-		if err := cnf.MergeInConfig(); err != nil {
-			return nil, err
+	src := &source{opts: opts, files: []string{realPath}}
+	src.addLayer(LayerBase, realPath)
+	data, err := ioutil.ReadFile(realPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc, included, err := src.readDoc(data, docRef{path: realPath}); err != nil {
+		return nil, nil, err
+	} else if included {
+		if err := readMap(cnf, doc); err != nil {
+			return nil, nil, err
+		}
+		cnf.SetConfigType(ext)
+	}
+	// profile by appmode
+	mode, ok := lookupFlag(opts, "appmode")
+	if !ok {
+		mode, ok = lookupEnv(opts, "appmode")
+	}
+	if !ok {
+		mode = cnf.GetString("appmode")
+	}
+	if mode != "" && mode != "local" {
+		if err := src.mergeFile(cnf, LayerProfile, path.Join(configPath, filename+"-"+mode+"."+ext)); err != nil {
+			return nil, nil, err
 		}
 	}
+	// fragments in lexical order
+	confDir := opts.ConfDir
+	if confDir == "" {
+		confDir = path.Join(configPath, defaultConfDir)
+	} else if !filepath.IsAbs(confDir) {
+		confDir = path.Join(configPath, confDir)
+	}
+	if err := src.mergeDir(cnf, LayerConfD, confDir); err != nil {
+		return nil, nil, err
+	}
+	// local
+	if err := src.mergeFile(cnf, LayerLocal, path.Join(configPath, filename+"-local."+ext)); err != nil {
+		return nil, nil, err
+	}
+	if err := src.mergeEnv(cnf); err != nil {
+		return nil, nil, err
+	}
+	if err := src.mergeFlags(cnf); err != nil {
+		return nil, nil, err
+	}
+	if err := src.decryptSecrets(cnf); err != nil {
+		return nil, nil, err
+	}
+	if err := src.interpolate(cnf); err != nil {
+		return nil, nil, err
+	}
+	cnf.SetConfigType(ext)
 	defaultSet(cnf)
-	return cnf, nil
+	return cnf, src, nil
 }
 
 // LoadRemoteConfig loads configuration from the config center and populates it into the Config variable.
-// To enable remote support in Viper, do a blank import of the viper/remote package:
-// current only support etcd
+// The provider selected by opts.Provider must be built before loading,such as etcdv3.Build,consul.Build or httpconf.Build.
 func LoadRemoteConfig(opts *options.Options) (*viper.Viper, error) {
+	cnf, src, err := loadRemoteConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	storeSource(cnf, src)
+	return cnf, nil
+}
+
+func loadRemoteConfig(opts *options.Options) (*viper.Viper, *source, error) {
+	applyConfigFlag(opts)
+	rPath := remoteConfigPath(opts)
 	cnf := viper.New()
-	cnf.AddRemoteProvider("etcd", opts.Addr, path.Clean(opts.Path)+"/"+opts.FileName)
+	cnf.AddRemoteProvider(remoteProvider(opts), opts.Addr, rPath)
 	cnf.SetConfigType("yaml")
-	if err := cnf.ReadRemoteConfig(); err != nil {
-		return nil, err
+	src := &source{opts: opts, remote: true}
+	ref := docRef{provider: remoteProvider(opts), path: rPath}
+	doc, err := src.loadRemoteDoc(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the remote configuration is kept in the config layer as the local one,
+	// so that the later layers merge with it
+	if err := readMap(cnf, doc); err != nil {
+		return nil, nil, err
+	}
+	if src.stale.IsZero() {
+		src.addLayer(LayerRemote, ref.String())
+	} else {
+		src.addLayer(LayerRemote, opts.SnapshotFile)
+	}
+	if err := src.mergeEnv(cnf); err != nil {
+		return nil, nil, err
+	}
+	if err := src.mergeFlags(cnf); err != nil {
+		return nil, nil, err
+	}
+	if err := src.decryptSecrets(cnf); err != nil {
+		return nil, nil, err
+	}
+	if err := src.interpolate(cnf); err != nil {
+		return nil, nil, err
 	}
 	defaultSet(cnf)
-	return cnf, nil
+	return cnf, src, nil
+}
+
+// the key of configuration in the config center
+func remoteConfigPath(opts *options.Options) string {
+	return path.Clean(opts.Path) + "/" + opts.FileName
 }
 
 type pathProvider struct {
@@ -114,57 +309,122 @@ func (t pathProvider) Path() string {
 }
 
 // 通过配置的key获取远程路径,读取返回字节数组
+// the provider is the one which cnf is loaded from,or the default provider if cnf is nil or local.
 func GetRemotePath(cnf *viper.Viper, remotePath string) (io.Reader, error) {
+	provider := DefaultProvider
+	if src, ok := lookupSource(cnf); ok && src.remote {
+		provider = remoteProvider(src.opts)
+	}
+	return getRemote(provider, remotePath)
+}
+
+// getRemote reads the key from the remote provider of name
+func getRemote(provider, remotePath string) (io.Reader, error) {
 	if remotePath == "" {
 		return nil, errors.New("key no found")
 	}
-	remote := viper.RemoteConfig
-	if remote == nil {
-		return nil, errors.New("viper miss RemoteConfig")
-	}
-	if r, err := remote.Get(&pathProvider{path: remotePath}); err != nil {
+	remote, err := lookupProvider(provider)
+	if err != nil {
 		return nil, err
-	} else {
-		return r, nil
 	}
+	return remote.Get(&pathProvider{path: remotePath})
 }
 
 // 从配置中读取配置源(文件流或者远程字节流),并读取源的[]byte设置为指定key的值
-// 当
+// 支持任意深度的key,源为glob时读取所有匹配的源为map,key为不含扩展名的文件名
+// Example:
+//	errors:
+//	  templates: ./errors/*.tmpl
+//	config.ResetFromSource(cnf, "errors.templates")
+//	tmpl := cnf.Get("errors.templates.notfound").([]byte)
 func ResetFromSource(cnf *viper.Viper, key string) error {
 	value := cnf.GetString(key)
 	if value == "" {
 		return nil
 	}
-	if strings.HasPrefix(value, ".") || strings.HasPrefix(value, "/") || viper.RemoteConfig == nil {
-		rPath := path.Join(path.Dir(cnf.ConfigFileUsed()), value)
-		if v, err := ioutil.ReadFile(rPath); err != nil {
+	provider := DefaultProvider
+	if src, ok := lookupSource(cnf); ok && src.remote {
+		provider = remoteProvider(src.opts)
+	}
+	var ref docRef
+	if _, err := lookupProvider(provider); strings.HasPrefix(value, ".") || strings.HasPrefix(value, "/") || err != nil {
+		ref = docRef{path: path.Join(path.Dir(cnf.ConfigFileUsed()), value)}
+	} else {
+		ref = docRef{provider: provider, path: value}
+	}
+	if hasGlob(ref.path) {
+		m, err := readGlob(ref)
+		if err != nil {
 			return err
-		} else {
-			setConfigValue(cnf, key, v)
 		}
-	} else if viper.RemoteConfig != nil {
-		if rd, err := GetRemotePath(cnf, value); err != nil {
-			return err
-		} else {
-			if v, err := ioutil.ReadAll(rd); err != nil {
-				return err
-			} else {
-				setConfigValue(cnf, key, v)
-			}
+		setConfigValue(cnf, key, m)
+		for k := range m {
+			recordOrigin(cnf, key+"."+k, ref.String())
 		}
+		return nil
+	}
+	v, err := ref.read()
+	if err != nil {
+		return err
 	}
+	setConfigValue(cnf, key, v)
+	recordOrigin(cnf, key, ref.String())
 	return nil
 }
 
-func setConfigValue(viper *viper.Viper, key string, value interface{}) {
-	keys := strings.Split(key, ".")
+// setConfigValue sets the value of the dotted key,the sibling keys are kept
+func setConfigValue(cnf *viper.Viper, key string, value interface{}) {
+	keys := strings.Split(strings.ToLower(key), ".")
 	if len(keys) == 1 {
-		viper.Set(key, value)
+		cnf.Set(key, value)
 		return
 	}
-	keyMap := viper.GetStringMap(keys[0])
-	keyMap[keys[1]] = value
+	// Set of a nested key shadows the siblings,so the top map is copied and set as a whole
+	root := copyMap(cnf.GetStringMap(keys[0]))
+	m := root
+	for _, k := range keys[1 : len(keys)-1] {
+		sub, ok := m[k].(map[string]interface{})
+		if !ok {
+			sub = copyMap(castMap(m[k]))
+		}
+		m[k] = sub
+		m = sub
+	}
+	m[keys[len(keys)-1]] = value
+	cnf.Set(keys[0], root)
+}
+
+func castMap(v interface{}) map[string]interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		r := make(map[string]interface{}, len(m))
+		for k, item := range m {
+			r[strings.ToLower(fmt.Sprint(k))] = item
+		}
+		return r
+	}
+	return nil
+}
+
+// copyMap copies the nested maps of m,the other values are shared
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	r := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if sub := castMap(v); sub != nil {
+			v = copyMap(sub)
+		}
+		r[k] = v
+	}
+	return r
+}
+
+// recordOrigin sets the origin of key which is changed after loading
+func recordOrigin(cnf *viper.Viper, key, origin string) {
+	if src, ok := lookupSource(cnf); ok {
+		src.record([]string{key}, origin)
+	}
 }
 
 func defaultSet(cnf *viper.Viper) {
@@ -0,0 +1,272 @@
+// Package consul provides the Consul KV remote provider of config,the changes are watched by blocking queries.
+// The address is the Consul HTTP API with options:
+//	127.0.0.1:8500?token=xxx&dc=dc1&wait=5m&timeout=10s
+//	https://consul.local:8501
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Name is the provider name of options.Options
+	Name = "consul"
+
+	defaultWait = 5 * time.Minute
+	retryDelay  = time.Second
+	// default timeout of reading a key,the remote is unreachable if it expires.
+	// a blocking query waits up to wait+wait/16 in addition.
+	requestTimeout = 10 * time.Second
+)
+
+// ErrKeyDeleted is sent by WatchChannel when the watched key is deleted
+var ErrKeyDeleted = errors.New("key is deleted")
+
+type consulConfigProvider struct {
+	Options *options.Options
+	client  *http.Client
+	// base url of the api,such as http://127.0.0.1:8500
+	addr  string
+	token string
+	dc    string
+	// max wait of the blocking queries
+	wait time.Duration
+	// timeout of the requests
+	timeout time.Duration
+}
+
+// Build registers the consul provider by options.Provider,default is Name
+func Build(options *options.Options) error {
+	provider, err := NewConsulConfigProvider(options)
+	if err != nil {
+		return err
+	}
+	config.RegisterProvider(options.Provider, provider)
+	return nil
+}
+
+func NewConsulConfigProvider(options *options.Options) (*consulConfigProvider, error) {
+	if options.Addr == "" {
+		return nil, errors.New("consul address is not set")
+	}
+	t := &consulConfigProvider{
+		Options: options,
+		client:  &http.Client{},
+		wait:    defaultWait,
+		timeout: requestTimeout,
+	}
+	if err := t.parseAddr(options.Addr); err != nil {
+		return nil, err
+	}
+	if options.Provider == "" {
+		options.Provider = Name
+	}
+	return t, nil
+}
+
+func (t *consulConfigProvider) parseAddr(addr string) error {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	t.token, t.dc = q.Get("token"), q.Get("dc")
+	if w := q.Get("wait"); w != "" {
+		if t.wait, err = time.ParseDuration(w); err != nil {
+			return fmt.Errorf("invalid wait %q: %s", w, err)
+		}
+	}
+	if v := q.Get("timeout"); v != "" {
+		if t.timeout, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid timeout %q: %s", v, err)
+		}
+	}
+	t.addr = u.Scheme + "://" + u.Host
+	return nil
+}
+
+// kvURL returns the url of the key with the query parameters
+func (t consulConfigProvider) kvURL(key string, query url.Values) string {
+	if t.dc != "" {
+		query.Set("dc", t.dc)
+	}
+	return t.addr + "/v1/kv/" + strings.TrimPrefix(key, "/") + "?" + query.Encode()
+}
+
+func (t consulConfigProvider) do(ctx context.Context, rawurl string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if t.token != "" {
+		req.Header.Set("X-Consul-Token", t.token)
+	}
+	return t.client.Do(req.WithContext(ctx))
+}
+
+// get returns the raw value and the modify index of key,a blocking query waits for a change after index
+func (t consulConfigProvider) get(ctx context.Context, key string, index uint64) ([]byte, uint64, error) {
+	query := url.Values{"raw": {""}}
+	timeout := t.timeout
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", t.wait.String())
+		timeout += t.wait + t.wait/16
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := t.do(ctx, t.kvURL(key, query))
+	if err != nil {
+		return nil, 0, &config.UnreachableError{Key: key, Err: err}
+	}
+	defer resp.Body.Close()
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, &config.UnreachableError{Key: key, Err: err}
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, newIndex, nil
+	case http.StatusNotFound:
+		return nil, newIndex, &config.NotFoundError{Key: key}
+	}
+	return nil, 0, statusError(key, resp.Status, resp.StatusCode, body)
+}
+
+// statusError converts the failed status to the typed errors of config
+func statusError(key, status string, code int, body []byte) error {
+	err := fmt.Errorf("consul: %s: %s", status, strings.TrimSpace(string(body)))
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &config.UnauthorizedError{Key: key, Err: err}
+	case code >= http.StatusInternalServerError:
+		return &config.UnreachableError{Key: key, Err: err}
+	}
+	return err
+}
+
+func (t consulConfigProvider) Get(rp viper.RemoteProvider) (io.Reader, error) {
+	val, _, err := t.get(context.Background(), rp.Path(), 0)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(val), nil
+}
+
+func (t consulConfigProvider) Watch(rp viper.RemoteProvider) (io.Reader, error) {
+	return t.Get(rp)
+}
+
+// WatchChannel sends the value of each change of the key until quit is closed or receives a value.
+// When the key is deleted,the response has an empty value and ErrKeyDeleted.
+func (t consulConfigProvider) WatchChannel(rp viper.RemoteProvider) (<-chan *viper.RemoteResponse, chan bool) {
+	quit := make(chan bool)
+	respCh := make(chan *viper.RemoteResponse)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-quit
+		cancel()
+	}()
+	go func() {
+		send := func(resp *viper.RemoteResponse) bool {
+			select {
+			case respCh <- resp:
+				return true
+			case <-quit:
+				return false
+			}
+		}
+		var (
+			index  uint64
+			last   []byte
+			exists bool
+		)
+		// the first query returns the current index
+		if val, idx, err := t.get(ctx, rp.Path(), 0); err == nil || config.IsNotFound(err) {
+			index, last, exists = idx, val, err == nil
+		}
+		for {
+			val, idx, err := t.get(ctx, rp.Path(), index)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !config.IsNotFound(err) {
+				if !send(&viper.RemoteResponse{Error: err}) {
+					return
+				}
+				select {
+				case <-time.After(retryDelay):
+				case <-quit:
+					return
+				}
+				continue
+			}
+			// the index must be reset if it goes backwards,and a query without index doesn't block
+			if idx < index {
+				idx = 0
+			}
+			index = idx
+			if index == 0 {
+				select {
+				case <-time.After(retryDelay):
+				case <-quit:
+					return
+				}
+			}
+			var resp *viper.RemoteResponse
+			switch {
+			case config.IsNotFound(err) && exists:
+				resp = &viper.RemoteResponse{Error: ErrKeyDeleted}
+			case err == nil && (!exists || !bytes.Equal(val, last)):
+				resp = &viper.RemoteResponse{Value: val}
+			}
+			last, exists = val, err == nil
+			if resp != nil && !send(resp) {
+				return
+			}
+		}
+	}()
+	return respCh, quit
+}
+
+// List returns the keys under prefix in lexical order,it is used by the remote globs of config
+func (t consulConfigProvider) List(prefix string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	resp, err := t.do(ctx, t.kvURL(prefix, url.Values{"keys": {""}}))
+	if err != nil {
+		return nil, &config.UnreachableError{Key: prefix, Err: err}
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, statusError(prefix, resp.Status, resp.StatusCode, body)
+	}
+	var keys []string
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
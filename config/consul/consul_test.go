@@ -0,0 +1,167 @@
+package consul_test
+
+import (
+	"encoding/json"
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/consul"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kvServer is a stand-in of the Consul KV api
+type kvServer struct {
+	mu      sync.Mutex
+	index   uint64
+	kvs     map[string]string
+	changed chan struct{}
+	token   string
+}
+
+func newKVServer() *kvServer {
+	return &kvServer{index: 1, kvs: make(map[string]string), changed: make(chan struct{})}
+}
+
+func (t *kvServer) put(key, value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.index++
+	if value == "" {
+		delete(t.kvs, key)
+	} else {
+		t.kvs[key] = value
+	}
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+func (t *kvServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t.token != "" && r.Header.Get("X-Consul-Token") != t.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	q := r.URL.Query()
+	t.mu.Lock()
+	if idx, _ := strconv.ParseUint(q.Get("index"), 10, 64); idx > 0 && idx >= t.index {
+		changed := t.changed
+		t.mu.Unlock()
+		wait, _ := time.ParseDuration(q.Get("wait"))
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+		t.mu.Lock()
+	}
+	defer t.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(t.index, 10))
+	if _, ok := q["keys"]; ok {
+		var keys []string
+		for k := range t.kvs {
+			if strings.HasPrefix(k, key) {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Strings(keys)
+		json.NewEncoder(w).Encode(keys)
+		return
+	}
+	v, ok := t.kvs[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Write([]byte(v))
+}
+
+func TestConsulConfig(t *testing.T) {
+	kv := newKVServer()
+	kv.token = "secret"
+	kv.put("app/config.yaml", "appname: app\nlog:\n  level: 1\nerrors:\n  $include: errors/*.yaml\n")
+	kv.put("app/errors/a.yaml", "notfound: not found\n")
+	kv.put("app/errors/b.yaml", "forbidden: forbidden\n")
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	opts := config.ParseOptions(config.Path("app"), config.FileName("config.yaml"),
+		config.Addr(srv.URL+"?token=secret&wait=1s"))
+	if err := consul.Build(opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Provider != consul.Name {
+		t.Fatalf("provider: %s", opts.Provider)
+	}
+	cnf, err := config.LoadConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.GetString("appname") != "app" || cnf.GetString("errors.forbidden") != "forbidden" {
+		t.Fatalf("settings: %v", cnf.AllSettings())
+	}
+	if src := config.Explain(cnf).Source("errors.notfound"); src != "consul://app/errors/a.yaml" {
+		t.Errorf("source of errors.notfound: %s", src)
+	}
+
+	w, err := config.Watch(cnf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	changed := make(chan interface{}, 1)
+	w.OnKeyChange("log.level", func(old, new interface{}) {
+		changed <- new
+	})
+	// wait for the blocking query
+	time.Sleep(100 * time.Millisecond)
+	kv.put("app/config.yaml", "appname: app\nlog:\n  level: 2\n")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change is not watched")
+	}
+	if config.Current(cnf).GetInt("log.level") != 2 {
+		t.Error("config is not reloaded")
+	}
+}
+
+func TestConsulUnresponsive(t *testing.T) {
+	quit := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-quit:
+		}
+	}))
+	defer srv.Close()
+	defer close(quit)
+
+	opts := config.ParseOptions(config.Path("app"), config.FileName("config.yaml"),
+		config.Addr(srv.URL+"?timeout=100ms"))
+	if err := consul.Build(opts); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := config.LoadConfig(opts)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !config.IsUnreachable(err) {
+			t.Errorf("expect unreachable error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("load is not timed out")
+	}
+}
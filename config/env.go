@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/spf13/viper"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var envKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// EnvPrefix enables the environment overrides of nested keys,the variable name is
+// the upper case key with the prefix,dots and dashes replaced by underscores.
+// Example:
+//	// APP_LOG_FILE_LEVEL=2 overrides log.file.level
+//	opts := config.ParseOptions(config.Path("config"), config.EnvPrefix("APP"))
+func EnvPrefix(prefix string) options.Option {
+	return func(o *options.Options) {
+		o.EnvPrefix = prefix
+	}
+}
+
+// EnvKeys sets the keys allowed to be overridden by the environment,the keys may be absent in the configuration.
+// Without EnvKeys all keys of the configuration are allowed.
+func EnvKeys(keys ...string) options.Option {
+	return func(o *options.Options) {
+		o.EnvKeys = append(o.EnvKeys, keys...)
+	}
+}
+
+// EnvName returns the environment variable name of key
+func EnvName(prefix, key string) string {
+	name := strings.ToUpper(envKeyReplacer.Replace(key))
+	if prefix = strings.TrimRight(prefix, "_"); prefix != "" {
+		name = strings.ToUpper(prefix) + "_" + name
+	}
+	return name
+}
+
+func envEnabled(opts *options.Options) bool {
+	return opts.EnvPrefix != "" || len(opts.EnvKeys) > 0
+}
+
+func envAllowed(opts *options.Options, key string) bool {
+	if len(opts.EnvKeys) == 0 {
+		return true
+	}
+	for _, k := range opts.EnvKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupEnv returns the raw environment value of key if the overrides are enabled
+func lookupEnv(opts *options.Options, key string) (string, bool) {
+	if !envEnabled(opts) || !envAllowed(opts, key) {
+		return "", false
+	}
+	return os.LookupEnv(EnvName(opts.EnvPrefix, key))
+}
+
+// mergeEnv merges the environment overrides into cnf,the values are converted to the type of the current values
+func (t *source) mergeEnv(cnf *viper.Viper) error {
+	if !envEnabled(t.opts) {
+		return nil
+	}
+	keys := t.opts.EnvKeys
+	if len(keys) == 0 {
+		keys = cnf.AllKeys()
+	}
+	override := make(map[string]interface{})
+	var names []string
+	for _, key := range keys {
+		key = strings.ToLower(key)
+		raw, ok := lookupEnv(t.opts, key)
+		if !ok {
+			continue
+		}
+		name := EnvName(t.opts.EnvPrefix, key)
+		val, err := coerceEnv(cnf.Get(key), raw)
+		if err != nil {
+			return fmt.Errorf("config: environment %s for key %s: %s", name, key, err)
+		}
+		setPath(override, strings.Split(key, "."), val)
+		names = append(names, name)
+		t.record([]string{key}, "$"+name)
+	}
+	if len(override) == 0 {
+		return nil
+	}
+	if err := mergeMap(cnf, override); err != nil {
+		return err
+	}
+	for _, name := range names {
+		t.addLayer(LayerEnv, "$"+name)
+	}
+	return nil
+}
+
+// coerceEnv converts raw to the type of current,lists are separated by comma.
+// If current is absent,ints,floats and bools are inferred.
+func coerceEnv(current interface{}, raw string) (interface{}, error) {
+	switch cv := current.(type) {
+	case nil:
+		if i, err := strconv.Atoi(raw); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f, nil
+		}
+		if b, err := strconv.ParseBool(raw); err == nil && (raw == "true" || raw == "false") {
+			return b, nil
+		}
+		return raw, nil
+	case int, int64, int32:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int %q", raw)
+		}
+		return i, nil
+	case float64, float32:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %q", raw)
+		}
+		return f, nil
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", raw)
+		}
+		return b, nil
+	case time.Duration:
+		if _, err := time.ParseDuration(raw); err != nil {
+			return nil, fmt.Errorf("invalid duration %q", raw)
+		}
+		return raw, nil
+	case string:
+		// a duration must be overridden by a duration
+		if _, err := time.ParseDuration(cv); err == nil && cv != "0" {
+			if _, err := time.ParseDuration(raw); err != nil {
+				return nil, fmt.Errorf("invalid duration %q", raw)
+			}
+		}
+		return raw, nil
+	case []interface{}, []string:
+		var items []interface{}
+		var first interface{}
+		if l, ok := cv.([]interface{}); ok && len(l) > 0 {
+			first = l[0]
+		}
+		for _, item := range strings.Split(raw, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			v, err := coerceEnv(first, item)
+			if err != nil {
+				return nil, err
+			}
+			if first == nil {
+				v = item
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	}
+	return raw, nil
+}
@@ -0,0 +1,129 @@
+package config_test
+
+import (
+	"github.com/qeelyn/go-common/config"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	if n := config.EnvName("APP_", "log.file.max-size"); n != "APP_LOG_FILE_MAX_SIZE" {
+		t.Error(n)
+	}
+	if n := config.EnvName("", "appmode"); n != "APPMODE" {
+		t.Error(n)
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"config.yaml":      "appmode: debug\nlog:\n  file:\n    level: 1\n    keep: false\n    flush: 1s\nhosts: [a]\nports: [80]\n",
+		"config-prod.yaml": "profile: prod\n",
+	})
+	env := map[string]string{
+		"APP_APPMODE":        "prod",
+		"APP_LOG_FILE_LEVEL": "2",
+		"APP_LOG_FILE_KEEP":  "true",
+		"APP_LOG_FILE_FLUSH": "5s",
+		"APP_HOSTS":          "a, b",
+		"APP_PORTS":          "80,81",
+		"APP_NEW_KEY":        "3",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	opts := config.ParseOptions(config.Path(dir), config.FileName("config.yaml"), config.EnvPrefix("APP"),
+		config.EnvKeys("appmode", "log.file.level", "log.file.keep", "log.file.flush", "hosts", "ports", "new.key"))
+	cnf, err := config.LoadConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.GetString("profile") != "prod" {
+		t.Error("profile must be selected by environment")
+	}
+	if v, ok := cnf.GetStringMap("log.file")["level"].(int); !ok || v != 2 {
+		t.Errorf("level:%v", cnf.GetStringMap("log.file")["level"])
+	}
+	if !cnf.GetBool("log.file.keep") || cnf.GetDuration("log.file.flush") != 5*time.Second {
+		t.Error("bool or duration override error")
+	}
+	if hosts := cnf.GetStringSlice("hosts"); len(hosts) != 2 || hosts[1] != "b" {
+		t.Errorf("hosts:%v", hosts)
+	}
+	if ports, _ := cnf.Get("ports").([]interface{}); len(ports) != 2 || ports[1] != 81 {
+		t.Errorf("ports:%v", cnf.Get("ports"))
+	}
+	if cnf.GetInt("new.key") != 3 {
+		t.Error("absent key must be overridden")
+	}
+
+	// not in the allow list
+	os.Setenv("APP_LOG_FILE_LEVEL", "abc")
+	opts.EnvKeys = []string{"appmode"}
+	if cnf, err = config.LoadConfig(opts); err != nil {
+		t.Fatal(err)
+	}
+	if cnf.GetInt("log.file.level") != 1 {
+		t.Error("key must not be overridden")
+	}
+	opts.EnvKeys = nil
+	if _, err = config.LoadConfig(opts); err == nil {
+		t.Error("invalid int must fail")
+	}
+}
+
+func TestAutomaticEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": "appmode: local\nlisten: \":8000\"\n",
+	})
+	os.Setenv("LISTEN", ":9000")
+	defer os.Unsetenv("LISTEN")
+	os.Setenv("APP_APPMODE", "test")
+	defer os.Unsetenv("APP_APPMODE")
+
+	// the unprefixed variables override without EnvPrefix or EnvKeys
+	opts := config.ParseOptions(config.Path(dir), config.FileName("config.yaml"))
+	cnf, err := config.LoadConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.GetString("listen") != ":9000" {
+		t.Errorf("listen: %s", cnf.GetString("listen"))
+	}
+	if s := config.Explain(cnf).Source("listen"); s != "$LISTEN" {
+		t.Errorf("source of listen: %s", s)
+	}
+
+	opts.EnvPrefix = "APP"
+	if cnf, err = config.LoadConfig(opts); err != nil {
+		t.Fatal(err)
+	}
+	if cnf.GetString("listen") != ":8000" {
+		t.Error("unprefixed variable must not override with EnvPrefix")
+	}
+	var envLayers []string
+	for _, l := range config.Layers(cnf) {
+		if l.Name == config.LayerEnv {
+			envLayers = append(envLayers, l.Source)
+		}
+	}
+	if len(envLayers) != 1 || envLayers[0] != "$APP_APPMODE" {
+		t.Errorf("env layers: %v", envLayers)
+	}
+	if s := config.Explain(cnf).Source("appmode"); s != "$APP_APPMODE" {
+		t.Errorf("source of appmode: %s", s)
+	}
+}
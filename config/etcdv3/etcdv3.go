@@ -5,23 +5,36 @@ import (
 	"context"
 	"errors"
 	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/qeelyn/go-common/config"
 	"github.com/qeelyn/go-common/config/options"
 	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"io"
-	"log"
+	"time"
 )
 
+// ErrKeyDeleted is sent by WatchChannel when the watched key is deleted
+var ErrKeyDeleted = errors.New("key is deleted")
+
+// timeout of reading a key,the remote is unreachable if it expires
+const requestTimeout = 10 * time.Second
+
 type etcdConfigProvider struct {
 	Options *options.Options
 	client  *clientv3.Client
 }
 
+// Build registers the etcd provider by options.Provider,default is config.DefaultProvider.
+// It is also set as the remote config of viper for the callers of viper.
 func Build(options *options.Options) error {
 	provider, err := NewEtcdConfigProvider(options)
 	if err != nil {
 		return err
 	}
+	config.RegisterProvider(options.Provider, provider)
 	viper.RemoteConfig = provider
 	return nil
 }
@@ -35,6 +48,9 @@ func NewEtcdConfigProvider(options *options.Options) (*etcdConfigProvider, error
 		return nil, errors.New("registry client is not an etcd v3 client")
 	}
 	options.Addr = client.Endpoints()[0]
+	if options.Provider == "" {
+		options.Provider = config.DefaultProvider
+	}
 	e := &etcdConfigProvider{
 		client:  client,
 		Options: options,
@@ -59,49 +75,96 @@ func (t etcdConfigProvider) Watch(rp viper.RemoteProvider) (io.Reader, error) {
 	return bytes.NewReader(val), nil
 }
 
+// WatchChannel sends the value of each change of the key until quit is closed or receives a value.
+// When the key is deleted,the response has an empty value and ErrKeyDeleted.
 func (t etcdConfigProvider) WatchChannel(rp viper.RemoteProvider) (<-chan *viper.RemoteResponse, chan bool) {
 	quit := make(chan bool)
-	quitwc := make(chan bool)
-	viperResponsCh := make(chan *viper.RemoteResponse)
-	rch := t.client.Watch(context.Background(), rp.Path(), clientv3.WithPrefix())
-	go func(rch *clientv3.WatchChan, vr chan<- *viper.RemoteResponse, quitwc <-chan bool, quit chan<- bool) {
+	respCh := make(chan *viper.RemoteResponse)
+	ctx, cancel := context.WithCancel(context.Background())
+	rch := t.client.Watch(ctx, rp.Path())
+	go func() {
+		defer cancel()
+		send := func(resp *viper.RemoteResponse) bool {
+			select {
+			case respCh <- resp:
+				return true
+			case <-quit:
+				return false
+			}
+		}
 		for {
 			select {
-			case <-quitwc:
-				quit <- true
+			case <-quit:
 				return
-			default:
-				for n := range *rch {
-					for _, ev := range n.Events {
-						switch ev.Type {
-						case mvccpb.PUT:
-							viperResponsCh <- &viper.RemoteResponse{
-								Error: n.Err(),
-								Value: ev.Kv.Value,
-							}
-							log.Print(1)
-						case mvccpb.DELETE:
-							log.Print(2)
-							quit <- true
-						}
+			case n, ok := <-rch:
+				if !ok {
+					return
+				}
+				if err := n.Err(); err != nil {
+					if !send(&viper.RemoteResponse{Error: err}) {
+						return
+					}
+					continue
+				}
+				for _, ev := range n.Events {
+					resp := &viper.RemoteResponse{Value: ev.Kv.Value}
+					if ev.Type == mvccpb.DELETE {
+						resp = &viper.RemoteResponse{Error: ErrKeyDeleted}
+					}
+					if !send(resp) {
+						return
 					}
 				}
 			}
-
 		}
+	}()
+	return respCh, quit
+}
 
-	}(&rch, viperResponsCh, quitwc, quit)
-	return viperResponsCh, quit
+// List returns the keys under prefix in lexical order,it is used by the remote globs of config
+func (t etcdConfigProvider) List(prefix string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := t.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, remoteError(prefix, err)
+	}
+	keys := make([]string, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		keys[i] = string(kv.Key)
+	}
+	return keys, nil
 }
 
 func (t etcdConfigProvider) etcdGet(rp viper.RemoteProvider) ([]byte, error) {
-	getResp, err := t.client.Get(context.Background(), rp.Path(), clientv3.WithPrefix())
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	getResp, err := t.client.Get(ctx, rp.Path(), clientv3.WithPrefix())
 	if err != nil {
-		return nil, err
+		return nil, remoteError(rp.Path(), err)
 	}
 	if len(getResp.Kvs) == 0 {
-		return nil, errors.New("key's value is empty")
+		return nil, &config.NotFoundError{Key: rp.Path()}
 	}
 	return getResp.Kvs[0].Value, nil
+}
 
+// remoteError converts the error of etcd client to the typed errors of config
+func remoteError(key string, err error) error {
+	switch err {
+	case rpctypes.ErrPermissionDenied, rpctypes.ErrAuthFailed, rpctypes.ErrInvalidAuthToken,
+		rpctypes.ErrInvalidAuthMgmt, rpctypes.ErrUserEmpty:
+		return &config.UnauthorizedError{Key: key, Err: err}
+	case context.DeadlineExceeded, context.Canceled, clientv3.ErrNoAvailableEndpoints,
+		rpctypes.ErrNoLeader, rpctypes.ErrTimeout, rpctypes.ErrTimeoutDueToConnectionLost, rpctypes.ErrTimeoutDueToLeaderFail:
+		return &config.UnreachableError{Key: key, Err: err}
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return &config.UnreachableError{Key: key, Err: err}
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return &config.UnauthorizedError{Key: key, Err: err}
+	}
+	return err
 }
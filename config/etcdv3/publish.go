@@ -0,0 +1,167 @@
+package etcdv3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coreos/etcd/clientv3"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const historyDir = ".history"
+
+var (
+	// ErrNotChanged is returned by Publish when the content equals to the current one
+	ErrNotChanged = errors.New("config is not changed")
+	// ErrRevisionNotFound is returned when the version is not in the history
+	ErrRevisionNotFound = errors.New("revision not found")
+	// ErrConflict is returned when the config is published by others concurrently
+	ErrConflict = errors.New("config is modified concurrently, try again")
+)
+
+// Revision is a published version of a configuration
+type Revision struct {
+	Version int64     `json:"version"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Content string    `json:"content"`
+}
+
+// Publisher publishes a configuration to the key read by the provider and keeps the numbered history.
+// The key of a configuration is path/filename as LoadRemoteConfig,
+// the history is kept in path/.history/filename/<version>.
+type Publisher struct {
+	client *clientv3.Client
+	key    string
+}
+
+func NewPublisher(client *clientv3.Client, key string) *Publisher {
+	return &Publisher{client: client, key: path.Clean(key)}
+}
+
+// HistoryPrefix returns the prefix of the history keys of key
+func HistoryPrefix(key string) string {
+	key = path.Clean(key)
+	return path.Join(path.Dir(key), historyDir, path.Base(key)) + "/"
+}
+
+func (t *Publisher) historyKey(version int64) string {
+	// fixed width for the lexical order of keys
+	return fmt.Sprintf("%s%010d", HistoryPrefix(t.key), version)
+}
+
+// Current returns the current content,nil if it is not published
+func (t *Publisher) Current(ctx context.Context) ([]byte, error) {
+	resp, err := t.client.Get(ctx, t.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+// Publish puts content to the key and appends it to the history
+func (t *Publisher) Publish(ctx context.Context, content []byte, message string) (*Revision, error) {
+	cur, err := t.client.Get(ctx, t.key)
+	if err != nil {
+		return nil, err
+	}
+	var modRev int64
+	if len(cur.Kvs) > 0 {
+		if bytes.Equal(cur.Kvs[0].Value, content) {
+			return nil, ErrNotChanged
+		}
+		modRev = cur.Kvs[0].ModRevision
+	}
+	last, err := t.lastVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rev := &Revision{
+		Version: last + 1,
+		Time:    time.Now(),
+		Message: message,
+		Content: string(content),
+	}
+	record, err := json.Marshal(rev)
+	if err != nil {
+		return nil, err
+	}
+	hk := t.historyKey(rev.Version)
+	resp, err := t.client.Txn(ctx).If(
+		clientv3.Compare(clientv3.ModRevision(t.key), "=", modRev),
+		clientv3.Compare(clientv3.CreateRevision(hk), "=", 0),
+	).Then(
+		clientv3.OpPut(t.key, string(content)),
+		clientv3.OpPut(hk, string(record)),
+	).Commit()
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		return nil, ErrConflict
+	}
+	return rev, nil
+}
+
+func (t *Publisher) lastVersion(ctx context.Context) (int64, error) {
+	opts := append([]clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithKeysOnly()}, clientv3.WithLastKey()...)
+	resp, err := t.client.Get(ctx, HistoryPrefix(t.key), opts...)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(strings.TrimPrefix(string(resp.Kvs[0].Key), HistoryPrefix(t.key)), 10, 64)
+}
+
+// History returns all revisions in ascending order of version
+func (t *Publisher) History(ctx context.Context) ([]*Revision, error) {
+	resp, err := t.client.Get(ctx, HistoryPrefix(t.key), clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+	revs := make([]*Revision, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		rev := &Revision{}
+		if err := json.Unmarshal(kv.Value, rev); err != nil {
+			return nil, fmt.Errorf("invalid history %s: %s", kv.Key, err)
+		}
+		revs = append(revs, rev)
+	}
+	return revs, nil
+}
+
+// Revision returns the revision of version
+func (t *Publisher) Revision(ctx context.Context, version int64) (*Revision, error) {
+	resp, err := t.client.Get(ctx, t.historyKey(version))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrRevisionNotFound
+	}
+	rev := &Revision{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, rev); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// Rollback publishes the content of version as a new revision
+func (t *Publisher) Rollback(ctx context.Context, version int64) (*Revision, error) {
+	rev, err := t.Revision(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return t.Publish(ctx, []byte(rev.Content), fmt.Sprintf("rollback to %d", version))
+}
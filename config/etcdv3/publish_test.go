@@ -0,0 +1,125 @@
+package etcdv3_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/qeelyn/go-common/config/etcdv3"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	retcd3 "github.com/qeelyn/go-common/grpcx/registry/etcdv3"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newPublisher(t *testing.T) (*etcdv3.Publisher, *clientv3.Client, string) {
+	rg, err := retcd3.NewRegistry(registry.Dsn("127.0.0.1:2379"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rg.GetClient().(*clientv3.Client)
+	key := fmt.Sprintf("go-common-test/%d/config.yaml", time.Now().UnixNano())
+	return etcdv3.NewPublisher(client, key), client, key
+}
+
+func cleanup(client *clientv3.Client, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client.Delete(ctx, key)
+	client.Delete(ctx, etcdv3.HistoryPrefix(key), clientv3.WithPrefix())
+	client.Close()
+}
+
+func TestPublisher(t *testing.T) {
+	pub, client, key := newPublisher(t)
+	defer cleanup(client, key)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if cur, err := pub.Current(ctx); err != nil || cur != nil {
+		t.Fatalf("current of a new key: %q %v", cur, err)
+	}
+	for i, content := range []string{"appname: v1\n", "appname: v2\n"} {
+		rev, err := pub.Publish(ctx, []byte(content), "m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rev.Version != int64(i+1) {
+			t.Errorf("version: %d", rev.Version)
+		}
+	}
+	if _, err := pub.Publish(ctx, []byte("appname: v2\n"), "m"); err != etcdv3.ErrNotChanged {
+		t.Errorf("expect not changed, got %v", err)
+	}
+	revs, err := pub.History(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 2 || revs[0].Content != "appname: v1\n" || revs[1].Version != 2 {
+		t.Errorf("history: %+v", revs)
+	}
+
+	rev, err := pub.Rollback(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Version != 3 || rev.Message != "rollback to 1" {
+		t.Errorf("rollback: %+v", rev)
+	}
+	if cur, _ := pub.Current(ctx); string(cur) != "appname: v1\n" {
+		t.Errorf("current after rollback: %q", cur)
+	}
+	if _, err := pub.Rollback(ctx, 1); err != etcdv3.ErrNotChanged {
+		t.Errorf("expect not changed, got %v", err)
+	}
+	if _, err := pub.Revision(ctx, 10); err != etcdv3.ErrRevisionNotFound {
+		t.Errorf("expect not found, got %v", err)
+	}
+}
+
+func TestPublisherConflict(t *testing.T) {
+	pub, client, key := newPublisher(t)
+	defer cleanup(client, key)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := pub.Publish(ctx, []byte(fmt.Sprintf("appname: v%d\n", i)), "m")
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	published := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			published++
+		case etcdv3.ErrConflict:
+		default:
+			t.Fatal(err)
+		}
+	}
+	revs, err := pub.History(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the guarded transaction keeps the versions continuous and the current content the latest one
+	if len(revs) != published {
+		t.Fatalf("published %d, history %d", published, len(revs))
+	}
+	for i, rev := range revs {
+		if rev.Version != int64(i+1) {
+			t.Errorf("version %d at %d", rev.Version, i)
+		}
+	}
+	if cur, _ := pub.Current(ctx); string(cur) != revs[len(revs)-1].Content {
+		t.Errorf("current %q is not the latest revision", cur)
+	}
+}
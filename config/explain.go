@@ -0,0 +1,162 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// the source of the keys which are not from any layer
+	OriginDefault = "default"
+	masked        = "******"
+)
+
+// SensitiveKeys are the parts of key names whose values are masked by Explain,
+// the decrypted values are always masked.
+var SensitiveKeys = []string{"password", "passwd", "secret", "private-key", "encryption-key", "token", "credential"}
+
+// KeyExplanation describes where the effective value of a key comes from
+type KeyExplanation struct {
+	Key    string      `json:"key" yaml:"key"`
+	Value  interface{} `json:"value" yaml:"value"`
+	Source string      `json:"source" yaml:"source"`
+}
+
+// Explanation is the merged configuration with the source of each key,the sensitive values are masked
+type Explanation struct {
+	Keys []KeyExplanation
+}
+
+// Explain returns the effective keys of cnf and their sources,such as the file path,
+// the environment variable,the remote key or the source of ResetFromSource.
+// Example:
+//	out, _ := config.Explain(cnf).YAML()
+//	http.Handle("/debug/config", config.ExplainHandler(cnf))
+func Explain(cnf *viper.Viper) *Explanation {
+	src, _ := lookupSource(cnf)
+	keys := cnf.AllKeys()
+	sort.Strings(keys)
+	exp := &Explanation{Keys: make([]KeyExplanation, 0, len(keys))}
+	for _, k := range keys {
+		ke := KeyExplanation{Key: k, Value: normalize(cnf.Get(k)), Source: OriginDefault}
+		if src != nil {
+			if o, ok := src.origins[k]; ok {
+				ke.Source = o
+			}
+		}
+		// viper AutomaticEnv overrides the keys without dots of the local configuration
+		if src != nil && !src.remote && !envEnabled(src.opts) && !strings.Contains(k, ".") {
+			if _, ok := os.LookupEnv(strings.ToUpper(k)); ok {
+				ke.Source = "$" + strings.ToUpper(k)
+			}
+		}
+		if (src != nil && src.secrets[k]) || isSensitive(k) {
+			ke.Value = masked
+		}
+		exp.Keys = append(exp.Keys, ke)
+	}
+	return exp
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range SensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Source returns the source of key,empty if the key is not set
+func (t *Explanation) Source(key string) string {
+	key = strings.ToLower(key)
+	for _, k := range t.Keys {
+		if k.Key == key {
+			return k.Source
+		}
+	}
+	return ""
+}
+
+// Settings returns the merged nested configuration
+func (t *Explanation) Settings() map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, k := range t.Keys {
+		setPath(m, strings.Split(k.Key, "."), k.Value)
+	}
+	return m
+}
+
+// YAML renders the merged configuration
+func (t *Explanation) YAML() ([]byte, error) {
+	return yaml.Marshal(t.Settings())
+}
+
+// JSON renders the merged configuration
+func (t *Explanation) JSON() ([]byte, error) {
+	return json.MarshalIndent(t.Settings(), "", "  ")
+}
+
+// normalize converts the yaml maps to map[string]interface{} for json
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = normalize(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = normalize(item)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(val))
+		for i, item := range val {
+			l[i] = normalize(item)
+		}
+		return l
+	case []byte:
+		return string(val)
+	}
+	return v
+}
+
+// ExplainHandler serves the configuration for the admin port,the latest one is served if cnf is watched.
+// Query parameters:
+//	format=yaml|json  default is yaml
+//	sources=1         lists each key with its source instead of the merged configuration
+func ExplainHandler(cnf *viper.Viper) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exp := Explain(Current(cnf))
+		var v interface{} = exp.Settings()
+		if r.URL.Query().Get("sources") == "1" {
+			v = exp.Keys
+		}
+		var (
+			out []byte
+			err error
+		)
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			out, err = json.MarshalIndent(v, "", "  ")
+		} else {
+			w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+			out, err = yaml.Marshal(v)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(out)
+	})
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"fmt"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigFlag is the flag of the configuration file registered by RegisterFlags,
+// it overrides the path and file name of the options,a directory overrides the path only.
+const ConfigFlag = "config"
+
+// the annotation of flags which holds the config key
+const flagKeyAnnotation = "config_key"
+
+// Flags sets the flags which override the keys as the highest layer,
+// the flags must be registered by RegisterFlags and parsed before loading.
+func Flags(fs *pflag.FlagSet) options.Option {
+	return func(o *options.Options) {
+		o.Flags = fs
+	}
+}
+
+// RegisterFlags registers a flag for each field of the struct pointed by v under the key prefix,
+// the flag name is the full key. The help text is from the `usage` tag and the default value is
+// from the `default` tag or the non-zero field value. If keys are given,only the fields of these keys
+// relative to prefix and their sub fields are registered. The flag --config is registered too.
+// Example:
+//	type DBConfig struct {
+//		Dsn          string `mapstructure:"dsn" usage:"data source name"`
+//		MaxOpenConns int    `mapstructure:"maxopenconns" default:"10"`
+//	}
+//	fs := pflag.NewFlagSet("app", pflag.ExitOnError)
+//	// --db.dsn and --db.maxopenconns
+//	config.RegisterFlags(fs, "db", &DBConfig{})
+//	fs.Parse(os.Args[1:])
+//	cnf, err := config.LoadConfig(config.ParseOptions(config.Path("config"), config.FileName("app.yaml"), config.Flags(fs)))
+func RegisterFlags(fs *pflag.FlagSet, prefix string, v interface{}, keys ...string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: RegisterFlags needs a pointer to struct, got %T", v)
+	}
+	if fs.Lookup(ConfigFlag) == nil {
+		fs.String(ConfigFlag, "", "configuration file or directory")
+	}
+	prefix = strings.ToLower(prefix)
+	declared := make([]string, len(keys))
+	for i, k := range keys {
+		declared[i] = joinKey(prefix, strings.ToLower(k))
+	}
+	return registerStruct(fs, rv.Elem(), prefix, declared)
+}
+
+// flagDeclared reports whether key or its parent or its child is declared
+func flagDeclared(declared []string, key string) bool {
+	if len(declared) == 0 {
+		return true
+	}
+	for _, d := range declared {
+		if d == key || strings.HasPrefix(key, d+".") || strings.HasPrefix(d, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func registerStruct(fs *pflag.FlagSet, rv reflect.Value, prefix string, declared []string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("mapstructure") == "-" {
+			continue
+		}
+		key := joinKey(prefix, fieldKey(f))
+		if !flagDeclared(declared, key) {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			if err := registerStruct(fs, fv, key, declared); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := registerField(fs, f, fv, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerField(fs *pflag.FlagSet, f reflect.StructField, fv reflect.Value, key string) error {
+	def, hasDefault := f.Tag.Lookup("default")
+	if !hasDefault && !isZero(fv) {
+		def, hasDefault = fmt.Sprint(fv.Interface()), true
+		if fv.Kind() == reflect.Slice {
+			var items []string
+			for i := 0; i < fv.Len(); i++ {
+				items = append(items, fmt.Sprint(fv.Index(i).Interface()))
+			}
+			def = strings.Join(items, ",")
+		}
+	}
+	usage := f.Tag.Get("usage")
+	invalid := func(err error) error {
+		return fmt.Errorf("config: invalid default %q of flag %s: %s", def, key, err)
+	}
+	switch {
+	case fv.Type() == reflect.TypeOf(time.Duration(0)):
+		var d time.Duration
+		if hasDefault {
+			var err error
+			if d, err = time.ParseDuration(def); err != nil {
+				return invalid(err)
+			}
+		}
+		fs.Duration(key, d, usage)
+	case fv.Kind() == reflect.String:
+		fs.String(key, def, usage)
+	case fv.Kind() == reflect.Bool:
+		var b bool
+		if hasDefault {
+			var err error
+			if b, err = strconv.ParseBool(def); err != nil {
+				return invalid(err)
+			}
+		}
+		fs.Bool(key, b, usage)
+	case fv.Kind() >= reflect.Int && fv.Kind() <= reflect.Int64:
+		var n int64
+		if hasDefault {
+			var err error
+			if n, err = strconv.ParseInt(def, 10, 64); err != nil {
+				return invalid(err)
+			}
+		}
+		fs.Int64(key, n, usage)
+	case fv.Kind() >= reflect.Uint && fv.Kind() <= reflect.Uint64:
+		var n uint64
+		if hasDefault {
+			var err error
+			if n, err = strconv.ParseUint(def, 10, 64); err != nil {
+				return invalid(err)
+			}
+		}
+		fs.Uint64(key, n, usage)
+	case fv.Kind() == reflect.Float32 || fv.Kind() == reflect.Float64:
+		var n float64
+		if hasDefault {
+			var err error
+			if n, err = strconv.ParseFloat(def, 64); err != nil {
+				return invalid(err)
+			}
+		}
+		fs.Float64(key, n, usage)
+	case fv.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range splitDefault(def) {
+			items = append(items, item.(string))
+		}
+		fs.StringSlice(key, items, usage)
+	default:
+		// maps and pointers are not supported by flags
+		return nil
+	}
+	return fs.SetAnnotation(key, flagKeyAnnotation, []string{key})
+}
+
+// flagValue returns the typed value of the flag
+func flagValue(fs *pflag.FlagSet, f *pflag.Flag) interface{} {
+	switch f.Value.Type() {
+	case "string", "duration":
+		return f.Value.String()
+	case "stringSlice":
+		items, _ := fs.GetStringSlice(f.Name)
+		return items
+	}
+	// numbers and bools
+	v, _ := coerceEnv(nil, f.Value.String())
+	return v
+}
+
+// lookupFlag returns the value of the changed flag of key
+func lookupFlag(opts *options.Options, key string) (string, bool) {
+	if opts.Flags == nil {
+		return "", false
+	}
+	f := opts.Flags.Lookup(key)
+	if f == nil || !f.Changed || len(f.Annotations[flagKeyAnnotation]) == 0 {
+		return "", false
+	}
+	return f.Value.String(), true
+}
+
+// applyConfigFlag overrides the path and file name of opts by --config
+func applyConfigFlag(opts *options.Options) {
+	if opts.Flags == nil {
+		return
+	}
+	f := opts.Flags.Lookup(ConfigFlag)
+	if f == nil || !f.Changed || f.Value.String() == "" {
+		return
+	}
+	file := f.Value.String()
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		opts.Path = file
+		return
+	}
+	dir, name := filepath.Split(file)
+	if dir != "" {
+		opts.Path = filepath.Clean(dir)
+	}
+	opts.FileName = name
+}
+
+// mergeFlags merges the changed flags into cnf as the highest layer
+func (t *source) mergeFlags(cnf *viper.Viper) error {
+	if t.opts.Flags == nil {
+		return nil
+	}
+	fs := t.opts.Flags
+	override := make(map[string]interface{})
+	var names []string
+	fs.Visit(func(f *pflag.Flag) {
+		keys := f.Annotations[flagKeyAnnotation]
+		if len(keys) == 0 {
+			return
+		}
+		setPath(override, strings.Split(keys[0], "."), flagValue(fs, f))
+		names = append(names, "--"+f.Name)
+		t.record(keys[:1], "--"+f.Name)
+	})
+	if len(override) == 0 {
+		return nil
+	}
+	if err := mergeMap(cnf, override); err != nil {
+		return err
+	}
+	for _, name := range names {
+		t.addLayer(LayerFlags, name)
+	}
+	return nil
+}
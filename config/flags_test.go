@@ -0,0 +1,107 @@
+package config_test
+
+import (
+	"github.com/qeelyn/go-common/config"
+	"github.com/spf13/pflag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type flagConfig struct {
+	AppMode string `mapstructure:"appmode" usage:"run mode"`
+	DB      struct {
+		Dsn          string        `mapstructure:"dsn" usage:"data source name"`
+		MaxOpenConns int           `mapstructure:"maxopenconns" default:"10"`
+		Timeout      time.Duration `mapstructure:"timeout" default:"3s"`
+		Hosts        []string      `mapstructure:"hosts"`
+	} `mapstructure:"db"`
+	Debug bool `mapstructure:"debug"`
+}
+
+func TestRegisterFlags(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	cfg := &flagConfig{}
+	cfg.DB.Dsn = "root@/app"
+	if err := config.RegisterFlags(fs, "", cfg, "appmode", "db"); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Lookup("debug") != nil {
+		t.Error("undeclared key is registered")
+	}
+	for name, def := range map[string]string{
+		"db.dsn":          "root@/app",
+		"db.maxopenconns": "10",
+		"db.timeout":      "3s",
+		config.ConfigFlag: "",
+	} {
+		f := fs.Lookup(name)
+		if f == nil {
+			t.Errorf("flag %s is not registered", name)
+			continue
+		}
+		if f.DefValue != def {
+			t.Errorf("default of %s: expect %s, got %s", name, def, f.DefValue)
+		}
+	}
+	if fs.Lookup("db.dsn").Usage != "data source name" {
+		t.Error("usage is not from the tag")
+	}
+}
+
+func TestFlagsLayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"app.yaml":      "db:\n  dsn: file\n  maxopenconns: 5\n  keep: true\n",
+		"app-prod.yaml": "profile: prod\n",
+	})
+	os.Setenv("APP_DB_DSN", "env")
+	defer os.Unsetenv("APP_DB_DSN")
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	if err := config.RegisterFlags(fs, "", &flagConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	err = fs.Parse([]string{"--config", filepath.Join(dir, "app.yaml"), "--db.dsn", "flag",
+		"--db.timeout", "5s", "--db.hosts", "a,b", "--appmode", "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := config.ParseOptions(config.Path("missing"), config.FileName("missing.yaml"),
+		config.EnvPrefix("APP"), config.Flags(fs))
+	cnf, err := config.LoadConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Path != dir || opts.FileName != "app.yaml" {
+		t.Errorf("--config is not applied: %s %s", opts.Path, opts.FileName)
+	}
+	if cnf.GetString("db.dsn") != "flag" {
+		t.Errorf("flag must override env: %s", cnf.GetString("db.dsn"))
+	}
+	if cnf.GetInt("db.maxopenconns") != 5 || !cnf.GetBool("db.keep") {
+		t.Error("unchanged flags must not override")
+	}
+	if cnf.GetDuration("db.timeout") != 5*time.Second {
+		t.Errorf("db.timeout: %v", cnf.Get("db.timeout"))
+	}
+	if hosts := cnf.GetStringSlice("db.hosts"); len(hosts) != 2 {
+		t.Errorf("db.hosts: %v", hosts)
+	}
+	if cnf.GetString("profile") != "prod" {
+		t.Error("profile must be selected by the flag")
+	}
+	if src := config.Explain(cnf).Source("db.dsn"); src != "--db.dsn" {
+		t.Errorf("source of db.dsn: %s", src)
+	}
+	layers := config.Layers(cnf)
+	if last := layers[len(layers)-1]; last.Name != config.LayerFlags {
+		t.Errorf("flags must be the last layer: %v", layers)
+	}
+}
@@ -0,0 +1,196 @@
+// Package httpconf provides the HTTP(S) remote provider of config,the configuration is served by
+// any http server at base url + path,the changes are polled with ETag.
+// The address is the base url with options which are not sent to the server:
+//	https://config.local/app?interval=30s&token=xxx
+// The token is sent as the bearer authorization.
+package httpconf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// Name is the provider name of options.Options
+	Name = "http"
+
+	defaultInterval = 30 * time.Second
+)
+
+// ErrKeyDeleted is sent by WatchChannel when the configuration is removed
+var ErrKeyDeleted = errors.New("key is deleted")
+
+type httpConfigProvider struct {
+	Options *options.Options
+	client  *http.Client
+	base    *url.URL
+	token   string
+	// interval of polling
+	interval time.Duration
+}
+
+// Build registers the http provider by options.Provider,default is Name
+func Build(options *options.Options) error {
+	provider, err := NewHttpConfigProvider(options)
+	if err != nil {
+		return err
+	}
+	config.RegisterProvider(options.Provider, provider)
+	return nil
+}
+
+func NewHttpConfigProvider(options *options.Options) (*httpConfigProvider, error) {
+	if options.Addr == "" {
+		return nil, errors.New("http address is not set")
+	}
+	u, err := url.Parse(options.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid http address %s", options.Addr)
+	}
+	t := &httpConfigProvider{
+		Options:  options,
+		client:   &http.Client{Timeout: time.Minute},
+		interval: defaultInterval,
+	}
+	q := u.Query()
+	t.token = q.Get("token")
+	if i := q.Get("interval"); i != "" {
+		if t.interval, err = time.ParseDuration(i); err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %s", i, err)
+		}
+	}
+	q.Del("token")
+	q.Del("interval")
+	u.RawQuery = q.Encode()
+	t.base = u
+	if options.Provider == "" {
+		options.Provider = Name
+	}
+	return t, nil
+}
+
+// url returns the url of the key based on the base url
+func (t httpConfigProvider) url(key string) string {
+	u := *t.base
+	u.Path = path.Join("/", u.Path, key)
+	return u.String()
+}
+
+// get returns the content and the etag,the content is nil if it is not modified since etag
+func (t httpConfigProvider) get(ctx context.Context, key, etag string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, t.url(key), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, "", &config.UnreachableError{Key: key, Err: err}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, resp.Header.Get("ETag"), nil
+	case http.StatusNotModified:
+		return nil, etag, nil
+	case http.StatusNotFound:
+		return nil, "", &config.NotFoundError{Key: key}
+	}
+	err = fmt.Errorf("http config: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, "", &config.UnauthorizedError{Key: key, Err: err}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, "", &config.UnreachableError{Key: key, Err: err}
+	}
+	return nil, "", err
+}
+
+func (t httpConfigProvider) Get(rp viper.RemoteProvider) (io.Reader, error) {
+	val, _, err := t.get(context.Background(), rp.Path(), "")
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(val), nil
+}
+
+func (t httpConfigProvider) Watch(rp viper.RemoteProvider) (io.Reader, error) {
+	return t.Get(rp)
+}
+
+// WatchChannel polls the key and sends the content of each change until quit is closed or receives a value.
+// When the key is removed,the response has an empty value and ErrKeyDeleted.
+func (t httpConfigProvider) WatchChannel(rp viper.RemoteProvider) (<-chan *viper.RemoteResponse, chan bool) {
+	quit := make(chan bool)
+	respCh := make(chan *viper.RemoteResponse)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		send := func(resp *viper.RemoteResponse) bool {
+			select {
+			case respCh <- resp:
+				return true
+			case <-quit:
+				return false
+			}
+		}
+		last, etag, err := t.get(ctx, rp.Path(), "")
+		exists := err == nil
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+			val, tag, err := t.get(ctx, rp.Path(), etag)
+			var resp *viper.RemoteResponse
+			switch {
+			case config.IsNotFound(err):
+				if exists {
+					resp = &viper.RemoteResponse{Error: ErrKeyDeleted}
+				}
+				exists, etag, last = false, "", nil
+			case err != nil:
+				resp = &viper.RemoteResponse{Error: err}
+			case val == nil:
+				// not modified
+			default:
+				// the servers without etag are compared by content
+				if !exists || !bytes.Equal(val, last) {
+					resp = &viper.RemoteResponse{Value: val}
+				}
+				exists, etag, last = true, tag, val
+			}
+			if resp != nil && !send(resp) {
+				return
+			}
+		}
+	}()
+	return respCh, quit
+}
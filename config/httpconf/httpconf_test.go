@@ -0,0 +1,96 @@
+package httpconf_test
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/httpconf"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fileServer serves the contents with ETag
+type fileServer struct {
+	mu          sync.Mutex
+	files       map[string]string
+	notModified int
+}
+
+func (t *fileServer) set(name, content string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files[name] = content
+}
+
+func (t *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	content, ok := t.files[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum([]byte(content)))
+	if r.Header.Get("If-None-Match") == etag {
+		t.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Write([]byte(content))
+}
+
+func TestHttpConfig(t *testing.T) {
+	fs := &fileServer{files: map[string]string{
+		"/base/app/config.yaml": "appname: app\nlog:\n  level: 1\n",
+	}}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+
+	opts := config.ParseOptions(config.Path("app"), config.FileName("config.yaml"),
+		config.Addr(srv.URL+"/base?token=secret&interval=50ms"))
+	if err := httpconf.Build(opts); err != nil {
+		t.Fatal(err)
+	}
+	cnf, err := config.LoadConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.GetInt("log.level") != 1 {
+		t.Fatalf("settings: %v", cnf.AllSettings())
+	}
+	if src := config.Explain(cnf).Source("appname"); src != "http://app/config.yaml" {
+		t.Errorf("source of appname: %s", src)
+	}
+
+	changes := make(chan []string, 1)
+	w, err := config.Watch(cnf, func(keys []string) {
+		changes <- keys
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	time.Sleep(200 * time.Millisecond)
+	fs.set("/base/app/config.yaml", "appname: app\nlog:\n  level: 2\n")
+	select {
+	case keys := <-changes:
+		if len(keys) != 1 || keys[0] != "log.level" {
+			t.Errorf("changed keys: %v", keys)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change is not polled")
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.notModified == 0 {
+		t.Error("etag is not used")
+	}
+}
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IncludeKey is the directive to include other documents into a map,the value is a path,a glob or a list of them.
+// A relative path is based on the including document,a local document includes local files and
+// a remote document includes remote keys of its provider,use the prefix file:// or the name of a built remote provider
+// such as etcd:// or consul:// to specify explicitly.
+// The keys of the including map override the included ones.
+// Example:
+//	db:
+//	  $include: db.yaml
+//	  maxopenconns: 10
+//	errors:
+//	  $include: ["errors/*.yaml", "etcd://common/errors.yaml"]
+const IncludeKey = "$include"
+
+const schemeFile = "file://"
+
+// RemoteLister is implemented by the remote providers which can list the keys under a prefix,
+// it is required by the globs of remote sources.
+type RemoteLister interface {
+	List(prefix string) ([]string, error)
+}
+
+// docRef locates a document,a local file or a remote key of the provider
+type docRef struct {
+	// the remote provider,empty for local files
+	provider string
+	path     string
+}
+
+func (t docRef) remote() bool {
+	return t.provider != ""
+}
+
+func (t docRef) String() string {
+	if t.remote() {
+		return t.provider + "://" + t.path
+	}
+	return t.path
+}
+
+// resolve returns the reference of p relative to t,the scheme must be file:// or the name of a built remote provider
+func (t docRef) resolve(p string) (docRef, error) {
+	if strings.HasPrefix(p, schemeFile) {
+		return docRef{path: filepath.Clean(strings.TrimPrefix(p, schemeFile))}, nil
+	}
+	if i := strings.Index(p, "://"); i > 0 {
+		provider := p[:i]
+		if _, err := lookupProvider(provider); err != nil {
+			return docRef{}, err
+		}
+		return docRef{provider: provider, path: path.Clean(p[i+len("://"):])}, nil
+	}
+	switch {
+	case t.remote():
+		if strings.HasPrefix(p, "/") {
+			return docRef{provider: t.provider, path: path.Clean(p)}, nil
+		}
+		return docRef{provider: t.provider, path: path.Join(path.Dir(t.path), p)}, nil
+	case filepath.IsAbs(p):
+		return docRef{path: filepath.Clean(p)}, nil
+	}
+	return docRef{path: filepath.Join(filepath.Dir(t.path), p)}, nil
+}
+
+func (t docRef) typ() string {
+	if ext := strings.TrimPrefix(path.Ext(t.path), "."); supportedExt(ext) {
+		return ext
+	}
+	return "yaml"
+}
+
+func hasGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// expand returns the matched references of the glob in lexical order
+func (t docRef) expand() ([]docRef, error) {
+	if !hasGlob(t.path) {
+		return []docRef{t}, nil
+	}
+	var matches []string
+	if t.remote() {
+		remote, err := lookupProvider(t.provider)
+		if err != nil {
+			return nil, err
+		}
+		lister, ok := remote.(RemoteLister)
+		if !ok {
+			return nil, fmt.Errorf("config: remote provider can't list keys for %s", t)
+		}
+		keys, err := lister.List(globPrefix(t.path))
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			if ok, _ := path.Match(t.path, k); ok {
+				matches = append(matches, k)
+			}
+		}
+	} else {
+		var err error
+		if matches, err = filepath.Glob(t.path); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(matches)
+	refs := make([]docRef, len(matches))
+	for i, m := range matches {
+		refs[i] = docRef{provider: t.provider, path: m}
+	}
+	return refs, nil
+}
+
+// globPrefix returns the part before the first meta character
+func globPrefix(p string) string {
+	if i := strings.IndexAny(p, "*?["); i != -1 {
+		return p[:i]
+	}
+	return p
+}
+
+func (t docRef) read() ([]byte, error) {
+	if !t.remote() {
+		return ioutil.ReadFile(t.path)
+	}
+	rd, err := getRemote(t.provider, t.path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(rd)
+}
+
+// includer loads documents and resolves the include directives
+type includer struct {
+	// the documents being loaded,for cycle detection
+	stack []string
+	// the origins of the included keys
+	origins map[string]string
+	// the included local files and the directories of local globs,for Watch
+	files []string
+	dirs  []string
+}
+
+func newIncluder() *includer {
+	return &includer{origins: make(map[string]string)}
+}
+
+// parse decodes data and resolves the includes,included reports whether the document has includes.
+// prefix is the key where the document is included.
+func (t *includer) parse(data []byte, ref docRef, prefix string) (doc map[string]interface{}, included bool, err error) {
+	for _, s := range t.stack {
+		if s == ref.String() {
+			return nil, false, fmt.Errorf("config: include cycle %s -> %s", strings.Join(t.stack, " -> "), ref)
+		}
+	}
+	t.stack = append(t.stack, ref.String())
+	defer func() { t.stack = t.stack[:len(t.stack)-1] }()
+
+	v := viper.New()
+	v.SetConfigType(ref.typ())
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, false, fmt.Errorf("config: parse %s: %s", ref, err)
+	}
+	doc = v.AllSettings()
+	included, err = t.resolve(doc, prefix, ref)
+	return doc, included, err
+}
+
+// load reads the document of ref which is included at prefix
+func (t *includer) load(ref docRef, prefix string) (map[string]interface{}, error) {
+	data, err := ref.read()
+	if err != nil {
+		return nil, err
+	}
+	doc, _, err := t.parse(data, ref, prefix)
+	return doc, err
+}
+
+// resolve replaces the include directives of m and its sub maps,prefix is the key of m
+func (t *includer) resolve(m map[string]interface{}, prefix string, ref docRef) (bool, error) {
+	included := false
+	for k, v := range m {
+		if sub, ok := v.(map[string]interface{}); ok {
+			ok, err := t.resolve(sub, joinKey(prefix, k), ref)
+			if err != nil {
+				return false, err
+			}
+			included = included || ok
+		}
+	}
+	inc, ok := m[IncludeKey]
+	if !ok {
+		return included, nil
+	}
+	delete(m, IncludeKey)
+	var patterns []string
+	switch val := inc.(type) {
+	case string:
+		patterns = []string{val}
+	case []interface{}:
+		for _, p := range val {
+			s, ok := p.(string)
+			if !ok {
+				return false, fmt.Errorf("config: invalid %s of %s in %s", IncludeKey, prefix, ref)
+			}
+			patterns = append(patterns, s)
+		}
+	default:
+		return false, fmt.Errorf("config: invalid %s of %s in %s", IncludeKey, prefix, ref)
+	}
+	// the keys of m override the included
+	own := make(map[string]bool)
+	for _, key := range flattenMap(m, prefix) {
+		own[key] = true
+	}
+	merged := make(map[string]interface{})
+	for _, p := range patterns {
+		pr, err := ref.resolve(p)
+		if err != nil {
+			return false, fmt.Errorf("config: include %s in %s: %s", p, ref, err)
+		}
+		refs, err := pr.expand()
+		if err != nil {
+			return false, err
+		}
+		if !pr.remote() && hasGlob(pr.path) {
+			t.dirs = append(t.dirs, filepath.Dir(pr.path))
+		}
+		for _, r := range refs {
+			if !r.remote() {
+				t.files = append(t.files, r.path)
+			}
+			doc, err := t.load(r, prefix)
+			if isRemoteError(err) {
+				return false, err
+			}
+			if err != nil {
+				return false, fmt.Errorf("config: include %s in %s: %s", r, ref, err)
+			}
+			for _, key := range flattenMap(doc, prefix) {
+				if _, ok := t.origins[key]; !ok && !own[key] {
+					t.origins[key] = r.String()
+				}
+			}
+			mergeInto(merged, doc)
+		}
+	}
+	mergeInto(merged, m)
+	for k := range m {
+		delete(m, k)
+	}
+	for k, v := range merged {
+		m[k] = v
+	}
+	return true, nil
+}
+
+// mergeInto merges src into dst recursively,the values of src win
+func mergeInto(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sv, ok := v.(map[string]interface{})
+		dv, dok := dst[k].(map[string]interface{})
+		if ok && dok {
+			mergeInto(dv, sv)
+			continue
+		}
+		if ok {
+			cp := make(map[string]interface{}, len(sv))
+			mergeInto(cp, sv)
+			v = cp
+		}
+		dst[k] = v
+	}
+}
+
+// flattenMap returns the dotted leaf keys of m
+func flattenMap(m map[string]interface{}, prefix string) []string {
+	var keys []string
+	for k, v := range m {
+		key := joinKey(prefix, k)
+		if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+			keys = append(keys, flattenMap(sub, key)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// readGlob reads the documents matched by the glob into a map,the key is the file name without extension
+func readGlob(ref docRef) (map[string]interface{}, error) {
+	refs, err := ref.expand()
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, errors.New("no source matches " + ref.String())
+	}
+	m := make(map[string]interface{}, len(refs))
+	for _, r := range refs {
+		data, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		name := path.Base(filepath.ToSlash(r.path))
+		m[strings.ToLower(strings.TrimSuffix(name, path.Ext(name)))] = data
+	}
+	return m, nil
+}
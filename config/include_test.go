@@ -0,0 +1,107 @@
+package config_test
+
+import (
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/options"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"config.yaml":           "appmode: test\ndb:\n  $include: db/main.yaml\n  maxopenconns: 20\nerrors:\n  $include: [\"errors/*.yaml\"]\n",
+		"db/main.yaml":          "dsn: root@tcp(localhost)/app\nmaxopenconns: 10\npool:\n  $include: pool.yaml\n",
+		"db/pool.yaml":          "idle: 5\n",
+		"errors/10-common.yaml": "notfound: not found\nforbidden: forbidden\n",
+		"errors/20-user.yaml":   "notfound: user not found\n",
+	})
+	cnf, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"db.dsn":           "root@tcp(localhost)/app",
+		"db.maxopenconns":  "20",
+		"db.pool.idle":     "5",
+		"errors.notfound":  "user not found",
+		"errors.forbidden": "forbidden",
+		"appmode":          "test",
+	} {
+		if got := cnf.GetString(key); got != want {
+			t.Errorf("%s: expect %s, got %s", key, want, got)
+		}
+	}
+	if cnf.IsSet("db.$include") {
+		t.Error("include directive is kept")
+	}
+	exp := config.Explain(cnf)
+	if got := exp.Source("db.pool.idle"); got != filepath.Join(dir, "db", "pool.yaml") {
+		t.Errorf("source of db.pool.idle: %s", got)
+	}
+	if got := exp.Source("db.maxopenconns"); got != filepath.Join(dir, "config.yaml") {
+		t.Errorf("source of db.maxopenconns: %s", got)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": "a:\n  $include: a.yaml\n",
+		"a.yaml":      "b:\n  $include: b.yaml\n",
+		"b.yaml":      "$include: a.yaml\n",
+	})
+	_, err = config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml"})
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expect cycle error, got %v", err)
+	}
+}
+
+func TestResetFromSourceDeep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"config.yaml":           "web:\n  tls:\n    cert: ./cert.pem\n    keep: true\n  port: 80\nerrors:\n  templates: ./tmpl/*.tmpl\n",
+		"cert.pem":              "CERT",
+		"tmpl/NotFound.tmpl":    "not found",
+		"tmpl/Forbidden.tmpl":   "forbidden",
+		"tmpl/ignored.yaml.bak": "ignored",
+	})
+	cnf, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ResetFromSource(cnf, "web.tls.cert"); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := cnf.Get("web.tls.cert").([]byte); !ok || string(v) != "CERT" {
+		t.Errorf("web.tls.cert: %v", cnf.Get("web.tls.cert"))
+	}
+	if !cnf.GetBool("web.tls.keep") || cnf.GetInt("web.port") != 80 {
+		t.Error("sibling keys are lost")
+	}
+	if err := config.ResetFromSource(cnf, "errors.templates"); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := cnf.GetStringMap("errors.templates")
+	if len(tmpl) != 2 {
+		t.Fatalf("templates: %v", tmpl)
+	}
+	if v, ok := cnf.Get("errors.templates.notfound").([]byte); !ok || string(v) != "not found" {
+		t.Errorf("errors.templates.notfound: %v", cnf.Get("errors.templates.notfound"))
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// the reference names in upper case are environment variables,the others are keys
+var envRefName = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// interpolator resolves the references in the values of a configuration:
+//	${ENV_VAR}          the environment variable
+//	${ENV_VAR:default}  the default is used if the variable is not set
+//	${other.key}        the value of another key,the type is kept if the value is a single reference
+//	${other.key:default}
+//	$${literal}         escapes the reference
+type interpolator struct {
+	cnf      *viper.Viper
+	src      *source
+	resolved map[string]interface{}
+	// the keys being resolved,for cycle detection
+	stack []string
+}
+
+// interpolate resolves the references of all values in cnf,it is applied after all layers are merged.
+// The keys referencing secrets become secrets.
+func (t *source) interpolate(cnf *viper.Viper) error {
+	r := &interpolator{cnf: cnf, src: t, resolved: make(map[string]interface{})}
+	for _, key := range cnf.AllKeys() {
+		raw := cnf.Get(key)
+		if !hasRef(raw) {
+			continue
+		}
+		v, err := r.value(key)
+		if err != nil {
+			return err
+		}
+		setConfigValue(cnf, key, v)
+	}
+	return nil
+}
+
+func hasRef(v interface{}) bool {
+	switch val := v.(type) {
+	case string:
+		return strings.Contains(val, "${")
+	case []interface{}:
+		for _, item := range val {
+			if hasRef(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// value returns the resolved value of key
+func (t *interpolator) value(key string) (interface{}, error) {
+	if v, ok := t.resolved[key]; ok {
+		return v, nil
+	}
+	for i, k := range t.stack {
+		if k == key {
+			return nil, fmt.Errorf("config: %s has a reference cycle %s -> %s", t.stack[0], strings.Join(t.stack[i:], " -> "), key)
+		}
+	}
+	t.stack = append(t.stack, key)
+	defer func() { t.stack = t.stack[:len(t.stack)-1] }()
+
+	var (
+		v   = t.cnf.Get(key)
+		err error
+	)
+	switch val := v.(type) {
+	case string:
+		v, err = t.expand(key, val)
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			if s, ok := item.(string); ok {
+				if list[i], err = t.expand(key, s); err != nil {
+					break
+				}
+				continue
+			}
+			list[i] = item
+		}
+		v = list
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.resolved[key] = v
+	return v, nil
+}
+
+// expand replaces the references in s which is the value of key
+func (t *interpolator) expand(key, s string) (interface{}, error) {
+	var (
+		buf  strings.Builder
+		rest = s
+	)
+	for {
+		i := strings.Index(rest, "${")
+		if i == -1 {
+			buf.WriteString(rest)
+			break
+		}
+		if i > 0 && rest[i-1] == '$' {
+			buf.WriteString(rest[:i-1] + "${")
+			rest = rest[i+2:]
+			continue
+		}
+		end := strings.Index(rest[i:], "}")
+		if end == -1 {
+			return nil, fmt.Errorf("config: %s has an unclosed reference in %q", key, s)
+		}
+		ref := rest[i+2 : i+end]
+		v, err := t.lookup(key, ref)
+		if err != nil {
+			return nil, err
+		}
+		// a single reference keeps the type of the referenced value
+		if i == 0 && end == len(rest)-1 && rest == s {
+			return v, nil
+		}
+		buf.WriteString(rest[:i])
+		buf.WriteString(fmt.Sprint(v))
+		rest = rest[i+end+1:]
+	}
+	return buf.String(), nil
+}
+
+// lookup returns the value of the reference name[:default] in the value of key
+func (t *interpolator) lookup(key, ref string) (interface{}, error) {
+	name, def := ref, ""
+	hasDef := false
+	if i := strings.Index(ref, ":"); i != -1 {
+		name, def, hasDef = ref[:i], ref[i+1:], true
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("config: %s has an empty reference", key)
+	}
+	if envRefName.MatchString(name) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, nil
+		}
+	} else if k := strings.ToLower(name); t.cnf.IsSet(k) {
+		v, err := t.value(k)
+		if err == nil && t.src.secrets[k] {
+			t.src.secrets[key] = true
+		}
+		return v, err
+	}
+	if hasDef {
+		return def, nil
+	}
+	return nil, fmt.Errorf("config: %s references undefined ${%s}", key, name)
+}
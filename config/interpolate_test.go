@@ -0,0 +1,74 @@
+package config_test
+
+import (
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/options"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `
+host: ${CONFIG_TEST_HOST:localhost}
+port: ${CONFIG_TEST_PORT:2379}
+registry:
+  dsn: ${host}:${port}
+db:
+  dsn: root@tcp(${host}:3306)/app
+  maxconns: ${pool.size}
+cache:
+  addrs: ["${host}:11211", "${CONFIG_TEST_CACHE:cache}:11211"]
+pool:
+  size: 10
+literal: $${host}
+`,
+	})
+	os.Setenv("CONFIG_TEST_HOST", "10.0.0.1")
+	defer os.Unsetenv("CONFIG_TEST_HOST")
+	cnf, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"registry.dsn": "10.0.0.1:2379",
+		"db.dsn":       "root@tcp(10.0.0.1:3306)/app",
+		"literal":      "${host}",
+	} {
+		if got := cnf.GetString(key); got != want {
+			t.Errorf("%s: expect %s, got %s", key, want, got)
+		}
+	}
+	if v, ok := cnf.Get("db.maxconns").(int); !ok || v != 10 {
+		t.Errorf("db.maxconns must keep the type: %#v", cnf.Get("db.maxconns"))
+	}
+	if addrs := cnf.GetStringSlice("cache.addrs"); len(addrs) != 2 || addrs[0] != "10.0.0.1:11211" || addrs[1] != "cache:11211" {
+		t.Errorf("cache.addrs: %v", addrs)
+	}
+}
+
+func TestInterpolateError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for content, want := range map[string]string{
+		"a: ${b}\nb: x${c}\nc: ${a}\n":       "reference cycle",
+		"db:\n  dsn: ${db.host}\n":           "db.dsn references undefined ${db.host}",
+		"db:\n  dsn: ${CONFIG_TEST_UNSET}\n": "db.dsn references undefined ${CONFIG_TEST_UNSET}",
+	} {
+		writeFiles(t, dir, map[string]string{"config.yaml": content})
+		_, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml"})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expect error %q, got %v", want, err)
+		}
+	}
+}
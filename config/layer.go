@@ -0,0 +1,181 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// the names of layers,the local configuration is merged in order:
+// base -> profile -> conf.d -> local -> env -> flags
+const (
+	LayerBase    = "base"
+	LayerProfile = "profile"
+	LayerConfD   = "conf.d"
+	LayerLocal   = "local"
+	LayerEnv     = "env"
+	LayerFlags   = "flags"
+	LayerRemote  = "remote"
+)
+
+const defaultConfDir = "conf.d"
+
+// Layer is a source merged into the configuration,the later layer overrides the earlier.
+type Layer struct {
+	Name string
+	// file path or the description of the source
+	Source string
+}
+
+func (t Layer) String() string {
+	return t.Name + ": " + t.Source
+}
+
+// Layers returns the applied layers of cnf in order,cnf must be returned by LoadConfig.
+// Example:
+//	for _, l := range config.Layers(cnf) {
+//		log.Printf("config layer %s", l)
+//	}
+func Layers(cnf *viper.Viper) []Layer {
+	src, ok := lookupSource(cnf)
+	if !ok {
+		return nil
+	}
+	return append([]Layer{}, src.layers...)
+}
+
+func (t *source) addLayer(name, source string) {
+	t.layers = append(t.layers, Layer{Name: name, Source: source})
+}
+
+// mergeFile merges the file into cnf if it exists
+func (t *source) mergeFile(cnf *viper.Viper, layer, file string) error {
+	t.files = append(t.files, file)
+	if _, err := os.Stat(file); err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	doc, included, err := t.readDoc(data, docRef{path: file})
+	if err != nil {
+		return err
+	}
+	if included {
+		err = mergeMap(cnf, doc)
+	} else {
+		cnf.SetConfigType(strings.TrimPrefix(path.Ext(file), "."))
+		err = cnf.MergeConfig(bytes.NewReader(data))
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to merge the configuration file %s: %s", file, err)
+	}
+	t.addLayer(layer, file)
+	return nil
+}
+
+// record sets the origin of keys
+func (t *source) record(keys []string, origin string) {
+	if t.origins == nil {
+		t.origins = make(map[string]string)
+	}
+	for _, k := range keys {
+		t.origins[strings.ToLower(k)] = origin
+	}
+}
+
+// readDoc decodes the document and resolves its includes,
+// the origins of its keys and the included files are recorded.
+func (t *source) readDoc(data []byte, ref docRef) (map[string]interface{}, bool, error) {
+	inc := newIncluder()
+	doc, included, err := inc.parse(data, ref, "")
+	if err != nil {
+		return nil, false, err
+	}
+	t.record(flattenMap(doc, ""), ref.String())
+	for k, o := range inc.origins {
+		t.record([]string{k}, o)
+	}
+	t.files = append(t.files, inc.files...)
+	t.dirs = append(t.dirs, inc.dirs...)
+	return doc, included, nil
+}
+
+// mergeDir merges the supported files of dir in lexical order
+func (t *source) mergeDir(cnf *viper.Viper, layer, dir string) error {
+	t.dirs = append(t.dirs, dir)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var files []string
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		if !supportedExt(path.Ext(info.Name())) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, info.Name()))
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		if err := t.mergeFile(cnf, layer, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeMap merges the nested map m into cnf,the values keep their types
+func mergeMap(cnf *viper.Viper, m map[string]interface{}) error {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	cnf.SetConfigType("yaml")
+	return cnf.MergeConfig(bytes.NewReader(data))
+}
+
+// readMap replaces the configuration of cnf with the nested map m
+func readMap(cnf *viper.Viper, m map[string]interface{}) error {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	cnf.SetConfigType("yaml")
+	return cnf.ReadConfig(bytes.NewReader(data))
+}
+
+func setPath(m map[string]interface{}, path []string, val interface{}) {
+	for _, p := range path[:len(path)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			m[p] = sub
+		}
+		m = sub
+	}
+	m[path[len(path)-1]] = val
+}
+
+func supportedExt(ext string) bool {
+	ext = strings.TrimPrefix(ext, ".")
+	for _, e := range viper.SupportedExts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package config_test
+
+import (
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/options"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		fp := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"config.yaml":         "appmode: test\nbase: base\nprofile: base\nfragment: base\nlocal: base\n",
+		"config-test.yaml":    "profile: test\nfragment: test\nlocal: test\n",
+		"config-prod.yaml":    "profile: prod\n",
+		"conf.d/20-b.json":    `{"fragment": "b"}`,
+		"conf.d/10-a.yaml":    "fragment: a\nlocal: a\n",
+		"conf.d/README.md":    "not a fragment",
+		"config-local.yaml":   "local: local\n",
+		"conf.d/.hidden.yaml": "fragment: hidden\n",
+	})
+	cnf, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"base": "base", "profile": "test", "fragment": "b", "local": "local"} {
+		if got := cnf.GetString(key); got != want {
+			t.Errorf("%s: expect %s, got %s", key, want, got)
+		}
+	}
+	want := []string{
+		config.LayerBase + ": " + filepath.Join(dir, "config.yaml"),
+		config.LayerProfile + ": " + filepath.Join(dir, "config-test.yaml"),
+		config.LayerConfD + ": " + filepath.Join(dir, "conf.d", "10-a.yaml"),
+		config.LayerConfD + ": " + filepath.Join(dir, "conf.d", "20-b.json"),
+		config.LayerLocal + ": " + filepath.Join(dir, "config-local.yaml"),
+	}
+	layers := config.Layers(cnf)
+	if len(layers) != len(want) {
+		t.Fatalf("layers:%v", layers)
+	}
+	for i, l := range layers {
+		if l.String() != want[i] {
+			t.Errorf("expect %s, got %s", want[i], l)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package options
 
-import "github.com/qeelyn/go-common/grpcx/registry"
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"github.com/spf13/pflag"
+	"time"
+)
 
 type Option func(*Options)
 
@@ -11,6 +16,26 @@ type Options struct {
 	FileName string
 	// registry center
 	Registry registry.Registry
-	// address of registry
+	// address of registry or the remote provider
 	Addr string
+	// name of the remote provider: etcd,consul or http,default is etcd
+	Provider string
+	// directory of fragments merged in lexical order,default is conf.d beside the config file
+	ConfDir string
+	// prefix of environment variables which override the nested keys,such as APP
+	EnvPrefix string
+	// keys allowed to be overridden by environment variables,empty means all keys
+	EnvKeys []string
+	// key to decrypt the ENC[...] values,or the file of the base64 key.
+	// if both are empty,the key is read from the environment,see package secret
+	SecretKey     []byte
+	SecretKeyFile string
+	// delay between a source change and the reload,zero means the default 500ms
+	WatchDebounce time.Duration
+	// file of the last-known-good remote configuration,empty disables the snapshot
+	SnapshotFile string
+	// parsed command-line flags which override the keys,see config.RegisterFlags
+	Flags *pflag.FlagSet
+	// registerer of the config metrics,default is prometheus.DefaultRegisterer
+	MetricsRegisterer prometheus.Registerer
 }
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/spf13/viper"
+	"io"
+	"sync"
+)
+
+// DefaultProvider is the remote provider without options.Options.Provider
+const DefaultProvider = "etcd"
+
+// RemoteProvider reads and watches the keys of a config center,it is the remote config of viper.
+type RemoteProvider interface {
+	Get(rp viper.RemoteProvider) (io.Reader, error)
+	Watch(rp viper.RemoteProvider) (io.Reader, error)
+	WatchChannel(rp viper.RemoteProvider) (<-chan *viper.RemoteResponse, chan bool)
+}
+
+// the remote providers by name
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]RemoteProvider)
+)
+
+// RegisterProvider registers the remote provider of name which is selected by options.Options.Provider,
+// it is called by the Build of the providers such as etcdv3.Build,the later one of the same name replaces the former.
+// Example:
+//	opts := config.ParseOptions(config.Provider("consul-b"), config.Addr("10.0.0.2:8500"))
+//	consul.Build(opts)
+func RegisterProvider(name string, provider RemoteProvider) {
+	providersMu.Lock()
+	providers[name] = provider
+	providersMu.Unlock()
+}
+
+// lookupProvider returns the registered provider of name,
+// the remote config of viper is the default provider if it is set directly.
+func lookupProvider(name string) (RemoteProvider, error) {
+	providersMu.RLock()
+	p, ok := providers[name]
+	providersMu.RUnlock()
+	if ok {
+		return p, nil
+	}
+	if name == DefaultProvider && viper.RemoteConfig != nil {
+		return viper.RemoteConfig, nil
+	}
+	return nil, fmt.Errorf("config: remote provider %s is not built", name)
+}
+
+// remoteProvider returns the name of the remote provider,default is etcd
+func remoteProvider(opts *options.Options) string {
+	if opts.Provider == "" {
+		return DefaultProvider
+	}
+	return opts.Provider
+}
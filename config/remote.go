@@ -0,0 +1,238 @@
+package config
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// NotFoundError is returned by the remote providers when the key doesn't exist
+type NotFoundError struct {
+	Key string
+}
+
+func (t *NotFoundError) Error() string {
+	return fmt.Sprintf("config: remote key %s is not found", t.Key)
+}
+
+// UnauthorizedError is returned by the remote providers when the credential is rejected
+type UnauthorizedError struct {
+	Key string
+	Err error
+}
+
+func (t *UnauthorizedError) Error() string {
+	return fmt.Sprintf("config: unauthorized to read remote key %s: %s", t.Key, t.Err)
+}
+
+// UnreachableError is returned by the remote providers when the remote can't be connected or is unavailable,
+// the snapshot is used if it is enabled.
+type UnreachableError struct {
+	Key string
+	Err error
+}
+
+func (t *UnreachableError) Error() string {
+	return fmt.Sprintf("config: remote is unreachable for key %s: %s", t.Key, t.Err)
+}
+
+func IsNotFound(err error) bool {
+	_, ok := err.(*NotFoundError)
+	return ok
+}
+
+func IsUnauthorized(err error) bool {
+	_, ok := err.(*UnauthorizedError)
+	return ok
+}
+
+func IsUnreachable(err error) bool {
+	_, ok := err.(*UnreachableError)
+	return ok
+}
+
+func isRemoteError(err error) bool {
+	return IsNotFound(err) || IsUnauthorized(err) || IsUnreachable(err)
+}
+
+// Snapshot sets the file of the last-known-good remote configuration,it is written after each successful
+// remote load and used when the remote is unreachable. The snapshot keeps the encrypted values as they are.
+// Example:
+//	opts := config.ParseOptions(config.Registry(r), config.Path("app"), config.FileName("config.yaml"),
+//		config.Snapshot("/var/lib/app/config.snapshot.yaml"))
+func Snapshot(file string) options.Option {
+	return func(o *options.Options) {
+		o.SnapshotFile = file
+	}
+}
+
+// Stale reports whether cnf is loaded from the snapshot because the remote is unreachable,
+// savedAt is the time of the snapshot.
+func Stale(cnf *viper.Viper) (savedAt time.Time, stale bool) {
+	src, ok := lookupSource(cnf)
+	if !ok || src.stale.IsZero() {
+		return time.Time{}, false
+	}
+	return src.stale, true
+}
+
+// readRemote reads the remote document and resolves its includes
+func (t *source) readRemote(ref docRef) (map[string]interface{}, error) {
+	rd, err := getRemote(ref.provider, ref.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	doc, _, err := t.readDoc(data, ref)
+	return doc, err
+}
+
+// readSnapshot reads the snapshot and returns the time it was saved
+func (t *source) readSnapshot() (map[string]interface{}, time.Time, error) {
+	file := t.opts.SnapshotFile
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	doc, _, err := t.readDoc(data, docRef{path: file})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return doc, info.ModTime(), nil
+}
+
+// writeSnapshot replaces the snapshot with doc atomically
+func writeSnapshot(file string, doc map[string]interface{}) error {
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// loadRemoteDoc reads the remote document,the snapshot is used if the remote is unreachable
+func (t *source) loadRemoteDoc(ref docRef) (map[string]interface{}, error) {
+	doc, err := t.readRemote(ref)
+	if t.opts.SnapshotFile == "" {
+		return doc, err
+	}
+	snapshots.register(t.opts.MetricsRegisterer)
+	if err == nil {
+		snapshots.set(ref.String(), time.Time{})
+		if err := writeSnapshot(t.opts.SnapshotFile, doc); err != nil {
+			log.Printf("config: failed to write the snapshot %s: %s", t.opts.SnapshotFile, err)
+		}
+		return doc, nil
+	}
+	if !IsUnreachable(err) {
+		return nil, err
+	}
+	// the origins of the snapshot replace the remote ones
+	t.origins = nil
+	snap, savedAt, serr := t.readSnapshot()
+	if serr != nil {
+		log.Printf("config: no snapshot for the unreachable remote %s: %s", ref, serr)
+		return nil, err
+	}
+	log.Printf("config: %s, use the snapshot %s saved at %s", err, t.opts.SnapshotFile, savedAt.Format(time.RFC3339))
+	t.stale = savedAt
+	snapshots.set(ref.String(), savedAt)
+	return snap, nil
+}
+
+// snapshotStaleness exports the staleness of the remote configurations which are loaded from the snapshots
+type snapshotStaleness struct {
+	desc *prometheus.Desc
+	mu   sync.Mutex
+	// saved time of the used snapshot by the remote source,zero if the remote is loaded
+	stale map[string]time.Time
+	// the registerers which the metric is registered to
+	registered map[prometheus.Registerer]bool
+}
+
+var snapshots = &snapshotStaleness{
+	desc: prometheus.NewDesc("config_snapshot_staleness_seconds",
+		"Seconds since the snapshot in use was saved, 0 if the remote configuration is loaded.",
+		[]string{"source"}, nil),
+	stale:      make(map[string]time.Time),
+	registered: make(map[prometheus.Registerer]bool),
+}
+
+// MetricsRegisterer sets the registerer of the snapshot staleness metric,default is prometheus.DefaultRegisterer.
+// The metric is registered when a snapshot is enabled.
+func MetricsRegisterer(r prometheus.Registerer) options.Option {
+	return func(o *options.Options) {
+		o.MetricsRegisterer = r
+	}
+}
+
+// register registers the metric to r once,the metric registered by others is kept.
+func (t *snapshotStaleness) register(r prometheus.Registerer) {
+	if r == nil {
+		r = prometheus.DefaultRegisterer
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.registered[r] {
+		return
+	}
+	if err := r.Register(t); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			log.Printf("config: failed to register the snapshot metric: %s", err)
+			return
+		}
+	}
+	t.registered[r] = true
+}
+
+func (t *snapshotStaleness) set(source string, savedAt time.Time) {
+	t.mu.Lock()
+	t.stale[source] = savedAt
+	t.mu.Unlock()
+}
+
+func (t *snapshotStaleness) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.desc
+}
+
+func (t *snapshotStaleness) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for source, savedAt := range t.stale {
+		var v float64
+		if !savedAt.IsZero() {
+			v = time.Since(savedAt).Seconds()
+		}
+		ch <- prometheus.MustNewConstMetric(t.desc, prometheus.GaugeValue, v, source)
+	}
+}
@@ -0,0 +1,230 @@
+package config_test
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/httpconf"
+	"github.com/qeelyn/go-common/config/options"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func remoteOptions(t *testing.T, addr, snapshot string) *options.Options {
+	opts := config.ParseOptions(config.Path("app"), config.FileName("config.yaml"),
+		config.Addr(addr), config.Snapshot(snapshot))
+	if err := httpconf.Build(opts); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+func TestRemoteSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "snapshot", "config.yaml")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("appname: app\ndb:\n  password: ENC[kept]\n"))
+	}))
+	cnf, err := config.LoadConfig(remoteOptions(t, srv.URL, snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, stale := config.Stale(cnf); stale {
+		t.Error("remote config must not be stale")
+	}
+	if _, err := os.Stat(snapshot); err != nil {
+		t.Fatal("snapshot is not written:", err)
+	}
+
+	srv.Close()
+	cnf, err = config.LoadConfig(remoteOptions(t, srv.URL, snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.GetString("appname") != "app" || cnf.GetString("db.password") != "ENC[kept]" {
+		t.Errorf("snapshot settings: %v", cnf.AllSettings())
+	}
+	if _, stale := config.Stale(cnf); !stale {
+		t.Error("config must be stale")
+	}
+	layers := config.Layers(cnf)
+	if layers[0].Name != config.LayerRemote || layers[0].Source != snapshot {
+		t.Errorf("layers: %v", layers)
+	}
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, mf := range mfs {
+		if mf.GetName() == "config_snapshot_staleness_seconds" {
+			for _, m := range mf.GetMetric() {
+				found = found || m.GetGauge().GetValue() > 0
+			}
+		}
+	}
+	if !found {
+		t.Error("staleness is not exported")
+	}
+
+	// no snapshot
+	_, err = config.LoadConfig(remoteOptions(t, srv.URL, ""))
+	if !config.IsUnreachable(err) {
+		t.Errorf("expect unreachable error, got %v", err)
+	}
+}
+
+func TestRemoteErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("case") {
+		case "unauthorized":
+			w.WriteHeader(http.StatusForbidden)
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(snapshot, []byte("appname: app\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for c, is := range map[string]func(error) bool{
+		"notfound":     config.IsNotFound,
+		"unauthorized": config.IsUnauthorized,
+	} {
+		// the snapshot is only used when the remote is unreachable
+		_, err := config.LoadConfig(remoteOptions(t, srv.URL+"?case="+c, snapshot))
+		if !is(err) {
+			t.Errorf("%s: unexpected error %v", c, err)
+		}
+	}
+	cnf, err := config.LoadConfig(remoteOptions(t, srv.URL+"?case=unavailable", snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, stale := config.Stale(cnf); !stale {
+		t.Error("the snapshot must be used when the remote is unavailable")
+	}
+}
+
+func TestSnapshotMetricsRegisterer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("appname: app\n"))
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	opts := remoteOptions(t, srv.URL, filepath.Join(dir, "config.yaml"))
+	config.MetricsRegisterer(reg)(opts)
+	for i := 0; i < 2; i++ {
+		if _, err := config.LoadConfig(opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "config_snapshot_staleness_seconds" {
+		t.Errorf("metrics: %v", mfs)
+	}
+}
+
+func TestProviderSelection(t *testing.T) {
+	var opts []*options.Options
+	for _, name := range []string{"a", "b"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("appname: " + name + "\n"))
+		}))
+		defer srv.Close()
+		o := config.ParseOptions(config.Path("app"), config.FileName("config.yaml"),
+			config.Addr(srv.URL), config.Provider("http-"+name))
+		if err := httpconf.Build(o); err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, o)
+	}
+	// each configuration is loaded from its provider regardless of the build order
+	for i, name := range []string{"a", "b"} {
+		cnf, err := config.LoadConfig(opts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cnf.GetString("appname") != name {
+			t.Errorf("provider http-%s: appname %s", name, cnf.GetString("appname"))
+		}
+	}
+	if _, err := config.LoadConfig(config.ParseOptions(config.Path("app"), config.FileName("config.yaml"),
+		config.Provider("absent"))); err == nil {
+		t.Error("expect the error of the absent provider")
+	}
+}
+
+func TestIncludeOtherProvider(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app/config.yaml":
+			w.Write([]byte("appname: app\ndb:\n  $include: common://shared/db.yaml\n"))
+		case "/app/absent.yaml":
+			w.Write([]byte("db:\n  $include: absent://shared/db.yaml\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer primary.Close()
+	common := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shared/db.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("dsn: root@/common\n"))
+	}))
+	defer common.Close()
+	if err := httpconf.Build(config.ParseOptions(config.Addr(common.URL), config.Provider("common"))); err != nil {
+		t.Fatal(err)
+	}
+	opts := config.ParseOptions(config.Path("app"), config.FileName("config.yaml"),
+		config.Addr(primary.URL), config.Provider("main"))
+	if err := httpconf.Build(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// the include is read from the provider of its scheme
+	cnf, err := config.LoadConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.GetString("db.dsn") != "root@/common" {
+		t.Errorf("db.dsn: %s", cnf.GetString("db.dsn"))
+	}
+	if s := config.Explain(cnf).Source("db.dsn"); s != "common://shared/db.yaml" {
+		t.Errorf("source of db.dsn: %s", s)
+	}
+
+	opts.FileName = "absent.yaml"
+	if _, err := config.LoadConfig(opts); err == nil || !strings.Contains(err.Error(), "absent") {
+		t.Errorf("expect the error of the absent provider, got %v", err)
+	}
+}
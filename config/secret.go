@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/qeelyn/go-common/config/secret"
+	"github.com/spf13/viper"
+	"strings"
+)
+
+// SecretKey sets the key to decrypt the ENC[...] values,see package secret
+func SecretKey(key []byte) options.Option {
+	return func(o *options.Options) {
+		o.SecretKey = key
+	}
+}
+
+// SecretKeyFile sets the file of the base64 key to decrypt the ENC[...] values
+func SecretKeyFile(file string) options.Option {
+	return func(o *options.Options) {
+		o.SecretKeyFile = file
+	}
+}
+
+func secretKey(opts *options.Options) ([]byte, error) {
+	if len(opts.SecretKey) > 0 {
+		if len(opts.SecretKey) != secret.KeySize {
+			return nil, secret.ErrInvalidKey
+		}
+		return opts.SecretKey, nil
+	}
+	if opts.SecretKeyFile != "" {
+		return secret.ReadKeyFile(opts.SecretKeyFile)
+	}
+	key, err := secret.KeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("no secret key, set %s or %s", secret.EnvKey, secret.EnvKeyFile)
+	}
+	return key, nil
+}
+
+// decryptSecrets replaces the encrypted values of cnf by the plain values,
+// the key is only required when there are encrypted values.
+func (t *source) decryptSecrets(cnf *viper.Viper) error {
+	var key []byte
+	decrypt := func(s string) (string, error) {
+		if !secret.IsEncrypted(s) {
+			return s, nil
+		}
+		if key == nil {
+			var err error
+			if key, err = secretKey(t.opts); err != nil {
+				return "", err
+			}
+		}
+		return secret.Decrypt(key, s)
+	}
+	plain := make(map[string]interface{})
+	for _, k := range cnf.AllKeys() {
+		v, changed, err := secret.Walk(cnf.Get(k), decrypt)
+		if err != nil {
+			return fmt.Errorf("config: decrypt key %s: %s", k, err)
+		}
+		if changed {
+			setPath(plain, strings.Split(k, "."), v)
+			if t.secrets == nil {
+				t.secrets = make(map[string]bool)
+			}
+			t.secrets[k] = true
+		}
+	}
+	if len(plain) == 0 {
+		return nil
+	}
+	return mergeMap(cnf, plain)
+}
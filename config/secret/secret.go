@@ -0,0 +1,198 @@
+// Package secret encrypts the sensitive values of configuration files.
+// An encrypted value looks like:
+//	ENC[AES256_GCM,data:<base64 ciphertext>,iv:<base64 nonce>]
+// The key is 32 bytes encoded by base64,it is read from the environment variable CONFIG_SECRET_KEY
+// or the file named by CONFIG_SECRET_KEY_FILE.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// EnvKey is the environment variable of the base64 key
+	EnvKey = "CONFIG_SECRET_KEY"
+	// EnvKeyFile is the environment variable of the key file path
+	EnvKeyFile = "CONFIG_SECRET_KEY_FILE"
+	// KeySize is the size of AES-256 key
+	KeySize = 32
+
+	prefix = "ENC[AES256_GCM,"
+	suffix = "]"
+)
+
+var (
+	ErrInvalidKey    = errors.New("secret: key must be 32 bytes encoded by base64")
+	ErrInvalidFormat = errors.New("secret: invalid encrypted value")
+	ErrDecrypt       = errors.New("secret: decrypt failed, the key may be wrong")
+)
+
+// IsEncrypted reports whether the value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix) && strings.HasSuffix(value, suffix)
+}
+
+// GenerateKey returns a random key encoded by base64
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes the base64 key
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// ReadKeyFile reads the base64 key from file
+func ReadKeyFile(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(string(data))
+}
+
+// KeyFromEnv reads the key from CONFIG_SECRET_KEY or CONFIG_SECRET_KEY_FILE,
+// it returns nil without error if neither is set.
+func KeyFromEnv() ([]byte, error) {
+	if s := os.Getenv(EnvKey); s != "" {
+		return ParseKey(s)
+	}
+	if f := os.Getenv(EnvKeyFile); f != "" {
+		return ReadKeyFile(f)
+	}
+	return nil, nil
+}
+
+// Encrypt encrypts plain into the ENC[...] format
+func Encrypt(key []byte, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	data := gcm.Seal(nil, nonce, []byte(plain), nil)
+	return fmt.Sprintf("%sdata:%s,iv:%s%s", prefix,
+		base64.StdEncoding.EncodeToString(data), base64.StdEncoding.EncodeToString(nonce), suffix), nil
+}
+
+// Decrypt decrypts the ENC[...] value
+func Decrypt(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", ErrInvalidFormat
+	}
+	var data, nonce []byte
+	for _, field := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, prefix), suffix), ",") {
+		kv := strings.SplitN(field, ":", 2)
+		if len(kv) != 2 {
+			return "", ErrInvalidFormat
+		}
+		b, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			return "", ErrInvalidFormat
+		}
+		switch kv[0] {
+		case "data":
+			data = b
+		case "iv":
+			nonce = b
+		}
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 || len(nonce) != gcm.NonceSize() {
+		return "", ErrInvalidFormat
+	}
+	plain, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Walk calls fn for each string in the nested value of yaml or json,and replaces the string by the result.
+// The changed reports whether any string is replaced.
+func Walk(value interface{}, fn func(string) (string, error)) (result interface{}, changed bool, err error) {
+	switch v := value.(type) {
+	case string:
+		s, err := fn(v)
+		if err != nil {
+			return nil, false, err
+		}
+		return s, s != v, nil
+	case map[string]interface{}:
+		for k, item := range v {
+			r, c, err := Walk(item, fn)
+			if err != nil {
+				return nil, false, err
+			}
+			if c {
+				v[k], changed = r, true
+			}
+		}
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			r, c, err := Walk(item, fn)
+			if err != nil {
+				return nil, false, err
+			}
+			if c {
+				v[k], changed = r, true
+			}
+		}
+	case yaml.MapSlice:
+		for i, item := range v {
+			r, c, err := Walk(item.Value, fn)
+			if err != nil {
+				return nil, false, err
+			}
+			if c {
+				v[i].Value, changed = r, true
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			r, c, err := Walk(item, fn)
+			if err != nil {
+				return nil, false, err
+			}
+			if c {
+				v[i], changed = r, true
+			}
+		}
+	}
+	return value, changed, nil
+}
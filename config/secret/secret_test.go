@@ -0,0 +1,55 @@
+package secret_test
+
+import (
+	"github.com/qeelyn/go-common/config/secret"
+	"testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	s, err := secret.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := secret.ParseKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := secret.Encrypt(key, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secret.IsEncrypted(enc) {
+		t.Errorf("invalid format:%s", enc)
+	}
+	plain, err := secret.Decrypt(key, enc)
+	if err != nil || plain != "password" {
+		t.Errorf("decrypt error:%s,%v", plain, err)
+	}
+	other, _ := secret.GenerateKey()
+	okey, _ := secret.ParseKey(other)
+	if _, err := secret.Decrypt(okey, enc); err != secret.ErrDecrypt {
+		t.Errorf("wrong key must fail:%v", err)
+	}
+	if _, err := secret.Decrypt(key, "ENC[AES256_GCM,data:abc]"); err != secret.ErrInvalidFormat {
+		t.Errorf("invalid format must fail:%v", err)
+	}
+	if _, err := secret.ParseKey("abc"); err != secret.ErrInvalidKey {
+		t.Error("short key must fail")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	v := map[string]interface{}{
+		"a": "x",
+		"b": []interface{}{"x", 1, map[interface{}]interface{}{"c": "x"}},
+	}
+	_, changed, err := secret.Walk(v, func(s string) (string, error) {
+		return s + "y", nil
+	})
+	if err != nil || !changed {
+		t.Fatal(err)
+	}
+	if v["a"] != "xy" || v["b"].([]interface{})[2].(map[interface{}]interface{})["c"] != "xy" {
+		t.Errorf("walk error:%v", v)
+	}
+}
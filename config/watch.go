@@ -0,0 +1,431 @@
+package config
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWatchDebounce = 500 * time.Millisecond
+	// interval to retry the remote when the configuration is loaded from the snapshot
+	staleRetryInterval = 30 * time.Second
+)
+
+// Watcher reloads a configuration when its sources change and notifies the subscribers.
+// The viper instance returned by LoadConfig is never modified,each reload builds a new one,
+// use Viper or Current to read the latest values safely from any goroutine.
+type Watcher struct {
+	src      *source
+	debounce time.Duration
+	// the viper instance passed to Watch
+	origin *viper.Viper
+
+	mu       sync.RWMutex
+	current  *viper.Viper
+	settings map[string]interface{}
+
+	subMu       sync.Mutex
+	handlers    []func(changedKeys []string)
+	keyHandlers map[string][]func(old, new interface{})
+
+	// the watch set of the local sources
+	files *fileWatch
+
+	trigger   chan struct{}
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+// watchers by the viper instance which returned by LoadConfig
+var (
+	watchersMu sync.Mutex
+	watchers   = make(map[*viper.Viper]*Watcher)
+)
+
+// Watch starts watching the sources of cnf,local files by fsnotify or the remote provider,
+// and calls onChange with the changed keys after each reload.
+// cnf must be returned by LoadConfig,LoadLocalConfig or LoadRemoteConfig.
+// Calling Watch again on the same cnf adds onChange to the existing watcher.
+// Example:
+//	w, err := config.Watch(cnf, func(changedKeys []string) {
+//		log.Println("config changed:", changedKeys)
+//	})
+//	w.OnKeyChange("log.file.level", func(old, new interface{}) {})
+//	level := config.Current(cnf).GetInt("log.file.level")
+func Watch(cnf *viper.Viper, onChange func(changedKeys []string)) (*Watcher, error) {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+	if w, ok := watchers[cnf]; ok {
+		w.OnChange(onChange)
+		return w, nil
+	}
+	src, ok := lookupSource(cnf)
+	if !ok {
+		return nil, fmt.Errorf("config: the configuration is not loaded by LoadConfig")
+	}
+	w := &Watcher{
+		src:         src,
+		debounce:    src.opts.WatchDebounce,
+		origin:      cnf,
+		current:     cnf,
+		settings:    flatten(cnf),
+		keyHandlers: make(map[string][]func(old, new interface{})),
+		trigger:     make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+	if w.debounce <= 0 {
+		w.debounce = defaultWatchDebounce
+	}
+	w.OnChange(onChange)
+	var err error
+	if src.remote {
+		err = w.watchRemote()
+	} else {
+		err = w.watchFiles()
+	}
+	if err != nil {
+		return nil, err
+	}
+	go w.run()
+	if !src.stale.IsZero() {
+		go w.retryStale()
+	}
+	watchers[cnf] = w
+	return w, nil
+}
+
+// Current returns the latest configuration of cnf if it is watched,otherwise cnf itself.
+func Current(cnf *viper.Viper) *viper.Viper {
+	watchersMu.Lock()
+	w, ok := watchers[cnf]
+	watchersMu.Unlock()
+	if !ok {
+		return cnf
+	}
+	return w.Viper()
+}
+
+// Viper returns the latest loaded configuration,it must be treated as read only.
+func (t *Watcher) Viper() *viper.Viper {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.current
+}
+
+// OnChange subscribes all changes,fn receives the sorted changed keys.
+func (t *Watcher) OnChange(fn func(changedKeys []string)) {
+	if fn == nil {
+		return
+	}
+	t.subMu.Lock()
+	t.handlers = append(t.handlers, fn)
+	t.subMu.Unlock()
+}
+
+// OnKeyChange subscribes the change of key,including the changes of its sub keys.
+func (t *Watcher) OnKeyChange(key string, fn func(old, new interface{})) {
+	key = strings.ToLower(key)
+	t.subMu.Lock()
+	t.keyHandlers[key] = append(t.keyHandlers[key], fn)
+	t.subMu.Unlock()
+}
+
+// Close stops watching,the last loaded configuration is still available
+// but the sources of the reloaded one are forgotten.
+func (t *Watcher) Close() {
+	t.closeOnce.Do(func() {
+		close(t.quit)
+		watchersMu.Lock()
+		for k, w := range watchers {
+			if w == t {
+				delete(watchers, k)
+			}
+		}
+		watchersMu.Unlock()
+		if cur := t.Viper(); cur != t.origin {
+			deleteSource(cur)
+		}
+	})
+}
+
+// notify schedules a reload,it never blocks.
+func (t *Watcher) notify() {
+	select {
+	case t.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// run reloads after the sources keep quiet for the debounce duration
+func (t *Watcher) run() {
+	var timer *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-t.quit:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-t.trigger:
+			if timer == nil {
+				timer = time.NewTimer(t.debounce)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(t.debounce)
+			}
+			fire = timer.C
+		case <-fire:
+			fire = nil
+			if err := t.Reload(); err != nil {
+				log.Printf("config: reload failed, keep the last configuration: %s", err)
+			}
+		}
+	}
+}
+
+// Reload loads the configuration from its sources immediately and notifies the subscribers if anything changed.
+func (t *Watcher) Reload() error {
+	cnf, src, err := t.src.load()
+	if err != nil {
+		return err
+	}
+	if t.files != nil {
+		if err := t.files.sync(src); err != nil {
+			log.Printf("config: failed to watch the sources: %s", err)
+		}
+	}
+	settings := flatten(cnf)
+
+	t.mu.Lock()
+	old := t.current
+	changed := diffSettings(t.settings, settings)
+	if len(changed) == 0 {
+		t.mu.Unlock()
+		// the same settings may be loaded from the remote instead of the snapshot
+		if cur, ok := lookupSource(old); ok && !cur.stale.Equal(src.stale) {
+			storeSource(old, src)
+		}
+		return nil
+	}
+	t.current = cnf
+	t.settings = settings
+	t.mu.Unlock()
+	// keep the source of the latest one for Layers and Explain
+	storeSource(cnf, src)
+	if old != t.origin {
+		deleteSource(old)
+	}
+
+	t.subMu.Lock()
+	handlers := append([]func([]string){}, t.handlers...)
+	keyHandlers := make(map[string][]func(old, new interface{}), len(t.keyHandlers))
+	for k, v := range t.keyHandlers {
+		keyHandlers[k] = v
+	}
+	t.subMu.Unlock()
+
+	for key, fns := range keyHandlers {
+		if !keyChanged(key, changed) {
+			continue
+		}
+		for _, fn := range fns {
+			fn(old.Get(key), cnf.Get(key))
+		}
+	}
+	for _, fn := range handlers {
+		fn(changed)
+	}
+	return nil
+}
+
+// retryStale reloads periodically until the configuration is not loaded from the snapshot,
+// the remote watch may not report the recovery.
+func (t *Watcher) retryStale() {
+	ticker := time.NewTicker(staleRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.quit:
+			return
+		case <-ticker.C:
+			if _, stale := Stale(t.Viper()); !stale {
+				return
+			}
+			t.notify()
+		}
+	}
+}
+
+func (t *Watcher) watchFiles() error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	t.files = &fileWatch{fw: fw, watched: make(map[string]bool)}
+	if err := t.files.sync(t.src); err != nil {
+		fw.Close()
+		return err
+	}
+	go func() {
+		defer fw.Close()
+		for {
+			select {
+			case <-t.quit:
+				return
+			case event, ok := <-fw.Events:
+				if !ok {
+					return
+				}
+				if t.files.match(event.Name) {
+					t.notify()
+				}
+			case err, ok := <-fw.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("config: watch error: %s", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// fileWatch is the watch set of the local sources,it is synced after each reload
+// because the files and includes may change.
+type fileWatch struct {
+	fw *fsnotify.Watcher
+
+	mu           sync.Mutex
+	files        map[string]bool
+	fragmentDirs map[string]bool
+	// the watched directories
+	watched map[string]bool
+}
+
+// sync watches the files and directories of src,the directories no longer used are removed.
+func (t *fileWatch) sync(src *source) error {
+	files := make(map[string]bool, len(src.files))
+	dirs := make(map[string]bool)
+	for _, f := range src.files {
+		f = filepath.Clean(f)
+		files[f] = true
+		dirs[filepath.Dir(f)] = true
+	}
+	// any change in the fragment directories
+	fragmentDirs := make(map[string]bool, len(src.dirs))
+	for _, d := range src.dirs {
+		d = filepath.Clean(d)
+		files[d] = true
+		dirs[filepath.Dir(d)] = true
+		if _, err := os.Stat(d); err == nil {
+			fragmentDirs[d] = true
+			dirs[d] = true
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// watch the directories to pick up renames and atomic saves
+	for dir := range dirs {
+		if t.watched[dir] {
+			continue
+		}
+		if err := t.fw.Add(dir); err != nil {
+			return err
+		}
+		t.watched[dir] = true
+	}
+	for dir := range t.watched {
+		if !dirs[dir] {
+			t.fw.Remove(dir)
+			delete(t.watched, dir)
+		}
+	}
+	t.files, t.fragmentDirs = files, fragmentDirs
+	return nil
+}
+
+// match reports whether the changed file is a source
+func (t *fileWatch) match(name string) bool {
+	name = filepath.Clean(name)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// kubernetes configmap updates the ..data symlink
+	return t.files[name] || t.fragmentDirs[filepath.Dir(name)] || filepath.Base(name) == "..data"
+}
+
+func (t *Watcher) watchRemote() error {
+	remote, err := lookupProvider(remoteProvider(t.src.opts))
+	if err != nil {
+		return err
+	}
+	respc, quit := remote.WatchChannel(&pathProvider{path: remoteConfigPath(t.src.opts)})
+	go func() {
+		for {
+			select {
+			case <-t.quit:
+				close(quit)
+				return
+			case resp, ok := <-respc:
+				if !ok {
+					return
+				}
+				if resp != nil && resp.Error != nil {
+					log.Printf("config: watch error: %s", resp.Error)
+				}
+				t.notify()
+			}
+		}
+	}()
+	return nil
+}
+
+// flatten returns all effective values by the dotted keys
+func flatten(cnf *viper.Viper) map[string]interface{} {
+	settings := make(map[string]interface{})
+	for _, k := range cnf.AllKeys() {
+		settings[k] = cnf.Get(k)
+	}
+	return settings
+}
+
+// diffSettings returns the sorted keys which are added,removed or modified
+func diffSettings(old, new map[string]interface{}) []string {
+	var changed []string
+	for k, v := range new {
+		if ov, ok := old[k]; !ok || !reflect.DeepEqual(ov, v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func keyChanged(key string, changed []string) bool {
+	for _, k := range changed {
+		if k == key || strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
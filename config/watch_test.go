@@ -0,0 +1,166 @@
+package config_test
+
+import (
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/options"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(file, []byte("appname: test\nlog:\n  level: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cnf, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml", WatchDebounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan []string, 1)
+	w, err := config.Watch(cnf, func(changedKeys []string) {
+		changes <- changedKeys
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	levels := make(chan interface{}, 1)
+	w.OnKeyChange("log", func(old, new interface{}) {
+		levels <- new
+	})
+	w.OnKeyChange("appname", func(old, new interface{}) {
+		t.Error("appname is not changed")
+	})
+
+	if err := ioutil.WriteFile(file, []byte("appname: test\nlog:\n  level: 2\nlisten: \":8000\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case keys := <-changes:
+		if len(keys) != 2 || keys[0] != "listen" || keys[1] != "log.level" {
+			t.Errorf("changed keys:%v", keys)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change is not notified")
+	}
+	if v := <-levels; v == nil {
+		t.Error("key change is not notified")
+	}
+	if config.Current(cnf).GetInt("log.level") != 2 {
+		t.Error("current config is not reloaded")
+	}
+	if cnf.GetInt("log.level") != 1 {
+		t.Error("loaded config must not be modified")
+	}
+}
+
+func TestWatchNotLoaded(t *testing.T) {
+	if _, err := config.Watch(nil, nil); err == nil {
+		t.Error("must fail without LoadConfig")
+	}
+}
+
+func TestWatchAddedInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(file, []byte("appname: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cnf, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml", WatchDebounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan []string, 1)
+	w, err := config.Watch(cnf, func(changedKeys []string) {
+		changes <- changedKeys
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	wait := func() []string {
+		select {
+		case keys := <-changes:
+			return keys
+		case <-time.After(5 * time.Second):
+			t.Fatal("change is not notified")
+		}
+		return nil
+	}
+
+	// the include is in a directory which is not watched before the reload
+	if err := os.Mkdir(filepath.Join(dir, "db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "db", "main.yaml"), []byte("dsn: a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("appname: test\ndb:\n  $include: db/main.yaml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if keys := wait(); len(keys) != 1 || keys[0] != "db.dsn" {
+		t.Errorf("changed keys:%v", keys)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "db", "main.yaml"), []byte("dsn: b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wait()
+	if dsn := config.Current(cnf).GetString("db.dsn"); dsn != "b" {
+		t.Errorf("the added include is not watched, dsn: %s", dsn)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(file, []byte("appname: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cnf, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml", WatchDebounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := config.Watch(cnf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("appname: changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	current := w.Viper()
+	if len(config.Layers(current)) == 0 {
+		t.Fatal("the reloaded configuration has no layers")
+	}
+
+	config.Release(cnf)
+	if config.Layers(cnf) != nil || config.Layers(current) != nil {
+		t.Error("the sources are kept after release")
+	}
+	if config.Current(cnf) != cnf {
+		t.Error("the watcher is kept after release")
+	}
+	if _, err := config.Watch(cnf, nil); err == nil {
+		t.Error("must fail after release")
+	}
+	// releasing again is harmless
+	config.Release(cnf)
+}
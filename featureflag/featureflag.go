@@ -0,0 +1,250 @@
+// Package featureflag evaluates the feature flags defined in the configuration by the organization and user
+// of the request,the flags are hot reloaded if the configuration is watched by config.Watch.
+// Configuration:
+//	featureflags:
+//	  new-dashboard:
+//	    enabled: true            # the switch of the flag,default is true
+//	    rules:                   # the flag is on if any rule matches,or there is no rule
+//	      - orgs: ["100", "200"] # all conditions of a rule must match
+//	      - percentage: 20       # stable rollout by the org id,by: user rolls out by the user id
+//	        by: org
+//	        from: 2018-09-01     # the date window,RFC3339 or date
+//	        until: 2018-10-01T00:00:00+08:00
+//	      - users: ["1"]
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"github.com/qeelyn/go-common/auth"
+	"github.com/qeelyn/go-common/config"
+	"github.com/spf13/viper"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultKey is the key of the flag definitions in the configuration
+const DefaultKey = "featureflags"
+
+const (
+	ByOrg  = "org"
+	ByUser = "user"
+)
+
+// Rule matches an identity if all of its conditions match
+type Rule struct {
+	// org ids and user ids,empty means any
+	Orgs  []string `mapstructure:"orgs"`
+	Users []string `mapstructure:"users"`
+	// the percentage of orgs or users in the rollout
+	Percentage float64 `mapstructure:"percentage" default:"100" validate:"min=0,max=100"`
+	By         string  `mapstructure:"by" default:"org" validate:"oneof=org user"`
+	// the window of time,empty means unbounded
+	From  string `mapstructure:"from"`
+	Until string `mapstructure:"until"`
+
+	from, until time.Time
+}
+
+// Flag is the definition of a feature flag
+type Flag struct {
+	Name    string `mapstructure:"-"`
+	Enabled bool   `mapstructure:"enabled" default:"true"`
+	Rules   []Rule `mapstructure:"rules"`
+}
+
+// Flags is the evaluated flags of an identity,absent flags are off
+type Flags map[string]bool
+
+func (t Flags) Enabled(name string) bool {
+	return t[strings.ToLower(name)]
+}
+
+// Set is the flags defined in a configuration
+type Set struct {
+	cnf *viper.Viper
+	key string
+
+	mu sync.Mutex
+	// the configuration which flags are parsed from
+	loaded *viper.Viper
+	flags  map[string]*Flag
+}
+
+// New parses the flags under key of cnf,empty key means DefaultKey.
+// The latest configuration is used if cnf is watched,an invalid definition keeps the last valid flags.
+// Example:
+//	cnf, _ := config.LoadConfig(opts)
+//	config.Watch(cnf, nil)
+//	flags, err := featureflag.New(cnf, "")
+//	if flags.Enabled(ctx, "new-dashboard") {
+//	}
+func New(cnf *viper.Viper, key string) (*Set, error) {
+	if key == "" {
+		key = DefaultKey
+	}
+	t := &Set{cnf: cnf, key: key}
+	cur := config.Current(cnf)
+	flags, err := parse(cur, key)
+	if err != nil {
+		return nil, err
+	}
+	t.loaded, t.flags = cur, flags
+	return t, nil
+}
+
+func parse(cnf *viper.Viper, key string) (map[string]*Flag, error) {
+	flags := make(map[string]*Flag)
+	for name := range cnf.GetStringMap(key) {
+		f := &Flag{Name: name}
+		if err := config.Bind(cnf, key+"."+name, f); err != nil {
+			return nil, fmt.Errorf("featureflag: %s", err)
+		}
+		for i := range f.Rules {
+			r := &f.Rules[i]
+			var err error
+			if r.from, err = parseTime(r.From); err != nil {
+				return nil, fmt.Errorf("featureflag: invalid from of %s.rules.%d: %s", name, i, err)
+			}
+			if r.until, err = parseTime(r.Until); err != nil {
+				return nil, fmt.Errorf("featureflag: invalid until of %s.rules.%d: %s", name, i, err)
+			}
+		}
+		flags[name] = f
+	}
+	return flags, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// definitions returns the flags of the latest configuration
+func (t *Set) definitions() map[string]*Flag {
+	cur := config.Current(t.cnf)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur != t.loaded {
+		flags, err := parse(cur, t.key)
+		if err != nil {
+			log.Printf("featureflag: keep the last flags: %s", err)
+		} else {
+			t.flags = flags
+		}
+		t.loaded = cur
+	}
+	return t.flags
+}
+
+// Names returns the sorted names of the defined flags
+func (t *Set) Names() []string {
+	defs := t.definitions()
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flag returns the definition of name
+func (t *Set) Flag(name string) (*Flag, bool) {
+	f, ok := t.definitions()[strings.ToLower(name)]
+	return f, ok
+}
+
+// Evaluate evaluates all flags for the identity,id may be nil
+func (t *Set) Evaluate(id *auth.Identity) Flags {
+	now := time.Now()
+	flags := make(Flags)
+	for name, f := range t.definitions() {
+		flags[name] = f.On(id, now)
+	}
+	return flags
+}
+
+// Enabled reports whether the flag is on for the identity of ctx,
+// the flags evaluated by the interceptor are used if present.
+func (t *Set) Enabled(ctx context.Context, name string) bool {
+	if flags, ok := FromContext(ctx); ok {
+		return flags.Enabled(name)
+	}
+	f, ok := t.Flag(name)
+	return ok && f.On(identityFromContext(ctx), time.Now())
+}
+
+// On reports whether the flag is on for the identity at now
+func (t *Flag) On(id *auth.Identity, now time.Time) bool {
+	if !t.Enabled {
+		return false
+	}
+	if len(t.Rules) == 0 {
+		return true
+	}
+	for i := range t.Rules {
+		if t.Rules[i].Match(t.Name, id, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the identity matches the rule of the flag at now
+func (t *Rule) Match(flag string, id *auth.Identity, now time.Time) bool {
+	if !t.from.IsZero() && now.Before(t.from) {
+		return false
+	}
+	if !t.until.IsZero() && !now.Before(t.until) {
+		return false
+	}
+	var orgId, userId string
+	if id != nil {
+		orgId, userId = id.OrgId, id.Id
+	}
+	if len(t.Orgs) > 0 && !contains(t.Orgs, orgId) {
+		return false
+	}
+	if len(t.Users) > 0 && !contains(t.Users, userId) {
+		return false
+	}
+	if t.Percentage >= 100 {
+		return true
+	}
+	subject := orgId
+	if t.By == ByUser {
+		subject = userId
+	}
+	if subject == "" {
+		return false
+	}
+	return bucket(flag, subject) < t.Percentage*100
+}
+
+func contains(list []string, s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// bucket hashes the subject into [0,10000),it is stable for the flag and subject
+func bucket(flag, subject string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(flag + ":" + subject))
+	return float64(h.Sum32() % 10000)
+}
@@ -0,0 +1,169 @@
+package featureflag_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/qeelyn/go-common/auth"
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/qeelyn/go-common/featureflag"
+	"google.golang.org/grpc"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const flagsYaml = `
+featureflags:
+  by-org:
+    rules:
+      - orgs: ["100", "200"]
+  by-user:
+    rules:
+      - users: ["1"]
+  disabled:
+    enabled: false
+  always: {}
+  rollout:
+    rules:
+      - percentage: 30
+        by: user
+  window:
+    rules:
+      - from: 2018-09-01
+        until: 2018-10-01T00:00:00Z
+`
+
+func load(t *testing.T, content string) (*config.Watcher, *featureflag.Set, func()) {
+	dir, err := ioutil.TempDir("", "featureflag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cnf, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := config.Watch(cnf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := featureflag.New(cnf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, set, func() {
+		w.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	_, set, clean := load(t, flagsYaml)
+	defer clean()
+
+	for _, c := range []struct {
+		id   *auth.Identity
+		want map[string]bool
+	}{
+		{nil, map[string]bool{"by-org": false, "by-user": false, "disabled": false, "always": true}},
+		{&auth.Identity{Id: "1", OrgId: "100"}, map[string]bool{"by-org": true, "by-user": true, "disabled": false}},
+		{&auth.Identity{Id: "2", OrgId: "300"}, map[string]bool{"by-org": false, "by-user": false}},
+	} {
+		flags := set.Evaluate(c.id)
+		for name, want := range c.want {
+			if flags.Enabled(name) != want {
+				t.Errorf("%s of %v: expect %v", name, c.id, want)
+			}
+		}
+	}
+
+	f, _ := set.Flag("window")
+	for now, want := range map[string]bool{
+		"2018-08-31T12:00:00Z": false,
+		"2018-09-15T00:00:00Z": true,
+		"2018-10-01T00:00:00Z": false,
+	} {
+		tm, _ := time.Parse(time.RFC3339, now)
+		if f.On(nil, tm) != want {
+			t.Errorf("window at %s: expect %v", now, want)
+		}
+	}
+}
+
+func TestRollout(t *testing.T) {
+	_, set, clean := load(t, flagsYaml)
+	defer clean()
+
+	f, _ := set.Flag("rollout")
+	on := 0
+	for i := 0; i < 10000; i++ {
+		id := &auth.Identity{Id: fmt.Sprint(i)}
+		first := f.On(id, time.Now())
+		if first != f.On(id, time.Now()) {
+			t.Fatal("rollout is not stable")
+		}
+		if first {
+			on++
+		}
+	}
+	if on < 2700 || on > 3300 {
+		t.Errorf("expect about 30%% rolled out, got %d of 10000", on)
+	}
+}
+
+func TestReload(t *testing.T) {
+	w, set, clean := load(t, "featureflags:\n  beta:\n    enabled: false\n")
+	defer clean()
+
+	ctx := context.WithValue(context.Background(), auth.ActiveUserContextKey, &auth.Identity{Id: "1", OrgId: "100"})
+	if set.Enabled(ctx, "beta") {
+		t.Fatal("beta must be off")
+	}
+	file := w.Viper().ConfigFileUsed()
+	if err := ioutil.WriteFile(file, []byte("featureflags:\n  beta:\n    rules:\n      - orgs: [\"100\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !set.Enabled(ctx, "beta") {
+		t.Error("beta must be on after reload")
+	}
+	// an invalid definition keeps the last flags
+	if err := ioutil.WriteFile(file, []byte("featureflags:\n  beta:\n    rules:\n      - by: team\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !set.Enabled(ctx, "beta") {
+		t.Error("the last valid flags must be kept")
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	_, set, clean := load(t, flagsYaml)
+	defer clean()
+
+	interceptor := featureflag.UnaryServerInterceptor(set)
+	ctx := context.WithValue(context.Background(), auth.ActiveUserContextKey, &auth.Identity{Id: "2", OrgId: "200"})
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		if !featureflag.Enabled(ctx, "by-org") || featureflag.Enabled(ctx, "by-user") {
+			flags, _ := featureflag.FromContext(ctx)
+			t.Errorf("flags in context: %v", flags)
+		}
+		if _, ok := featureflag.FromContext(ctx); !ok {
+			t.Error("flags are not in context")
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,60 @@
+package featureflag
+
+import (
+	"context"
+	"github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/qeelyn/go-common/auth"
+	"google.golang.org/grpc"
+)
+
+type flagsKey struct{}
+
+// NewContext returns a new context carrying the evaluated flags
+func NewContext(ctx context.Context, flags Flags) context.Context {
+	return context.WithValue(ctx, flagsKey{}, flags)
+}
+
+// FromContext returns the flags evaluated by the interceptor
+func FromContext(ctx context.Context) (Flags, bool) {
+	flags, ok := ctx.Value(flagsKey{}).(Flags)
+	return flags, ok
+}
+
+// Enabled reports whether the flag evaluated by the interceptor is on
+func Enabled(ctx context.Context, name string) bool {
+	flags, _ := FromContext(ctx)
+	return flags.Enabled(name)
+}
+
+// the identity set by the auth interceptor
+func identityFromContext(ctx context.Context) *auth.Identity {
+	switch id := ctx.Value(auth.ActiveUserContextKey).(type) {
+	case *auth.Identity:
+		return id
+	case auth.Identity:
+		return &id
+	}
+	return nil
+}
+
+// UnaryServerInterceptor evaluates the flags for the identity of the request,
+// it must be chained after the auth interceptor.
+// Example:
+//	grpcx.WithUnaryServerInterceptor(featureflag.UnaryServerInterceptor(flags))
+//	// in the handler
+//	if featureflag.Enabled(ctx, "new-dashboard") {
+//	}
+func UnaryServerInterceptor(set *Set) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(NewContext(ctx, set.Evaluate(identityFromContext(ctx))), req)
+	}
+}
+
+// StreamServerInterceptor is the stream version of UnaryServerInterceptor
+func StreamServerInterceptor(set *Set) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpc_middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = NewContext(ss.Context(), set.Evaluate(identityFromContext(ss.Context())))
+		return handler(srv, wrapped)
+	}
+}
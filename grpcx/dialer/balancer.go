@@ -0,0 +1,160 @@
+package dialer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	// VersionHeader routes the request to the nodes of the version
+	VersionHeader = "x-service-version"
+	// CanaryHeader routes the request to the canary nodes if it is "true"
+	CanaryHeader = "x-service-canary"
+
+	routingBalancerPrefix = "qeelyn_routing"
+)
+
+var (
+	routingBalancersMu sync.Mutex
+	routingBalancers   = make(map[string]bool)
+)
+
+// WithRouting routes the requests by the metadata of the nodes which are published by the registry,
+// the nodes are picked by round robin:
+// the nodes of the version in VersionHeader,the canary nodes if CanaryHeader is "true",
+// otherwise the nodes which are not canary.
+// The request fails with codes.Unavailable if no node of the version or no node which is not canary is ready,
+// or waits for one if it is not fail fast. The canary request falls back to the other nodes if no canary is ready.
+// Example:
+//	conn, err := dialer.Dial("qeelyn:///user", dialer.WithRouting())
+//	ctx = dialer.WithVersion(ctx, "v1.2.0")
+func WithRouting() Option {
+	return func(options *Options) {
+		options.Routing = true
+	}
+}
+
+// WithZone routes the requests as WithRouting and prefers the nodes of the zone,
+// the nodes of other zones are used if no node of the zone is ready.
+// Example:
+//	conn, err := dialer.Dial("qeelyn:///user", dialer.WithZone("hz-a"))
+func WithZone(zone string) Option {
+	return func(options *Options) {
+		options.Routing = true
+		options.Zone = zone
+	}
+}
+
+// WithVersion routes the requests of ctx to the nodes of the version
+func WithVersion(ctx context.Context, version string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, VersionHeader, version)
+}
+
+// WithCanary routes the requests of ctx to the canary nodes
+func WithCanary(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, CanaryHeader, "true")
+}
+
+// routingBalancerName registers the routing balancer of the zone once and returns its name,
+// zone is empty if there is no preferred zone.
+func routingBalancerName(zone string) string {
+	name := routingBalancerPrefix
+	if zone != "" {
+		name += "_" + zone
+	}
+	routingBalancersMu.Lock()
+	defer routingBalancersMu.Unlock()
+	if !routingBalancers[name] {
+		balancer.Register(base.NewBalancerBuilder(name, &routingPickerBuilder{zone: zone}))
+		routingBalancers[name] = true
+	}
+	return name
+}
+
+type routingPickerBuilder struct {
+	zone string
+}
+
+func (t *routingPickerBuilder) Build(readySCs map[resolver.Address]balancer.SubConn) balancer.Picker {
+	if len(readySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &routingPicker{zone: t.zone}
+	for addr, sc := range readySCs {
+		p.subConns = append(p.subConns, &subConn{sc: sc, md: registry.AddressMetadata(addr)})
+	}
+	return p
+}
+
+type subConn struct {
+	sc balancer.SubConn
+	md map[string]string
+}
+
+type routingPicker struct {
+	zone     string
+	subConns []*subConn
+	next     uint32
+}
+
+// filter returns the matched subConns
+func filter(subConns []*subConn, match func(*subConn) bool) []*subConn {
+	var matched []*subConn
+	for _, sc := range subConns {
+		if match(sc) {
+			matched = append(matched, sc)
+		}
+	}
+	return matched
+}
+
+// prefer returns the matched subConns,or all if none is matched
+func prefer(subConns []*subConn, match func(*subConn) bool) []*subConn {
+	if matched := filter(subConns, match); len(matched) > 0 {
+		return matched
+	}
+	return subConns
+}
+
+func header(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (t *routingPicker) Pick(ctx context.Context, opts balancer.PickOptions) (balancer.SubConn, func(balancer.DoneInfo), error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	var candidates []*subConn
+	if version := header(md, VersionHeader); version != "" {
+		candidates = filter(t.subConns, func(sc *subConn) bool {
+			return sc.md[registry.MetadataVersion] == version
+		})
+	} else if header(md, CanaryHeader) == "true" {
+		candidates = prefer(t.subConns, func(sc *subConn) bool {
+			return sc.md[registry.MetadataCanary] == "true"
+		})
+	} else {
+		candidates = filter(t.subConns, func(sc *subConn) bool {
+			return sc.md[registry.MetadataCanary] != "true"
+		})
+	}
+	if len(candidates) == 0 {
+		// codes.Unavailable for the fail fast requests,the others wait for the picker to be updated
+		return nil, nil, balancer.ErrTransientFailure
+	}
+	if t.zone != "" {
+		candidates = prefer(candidates, func(sc *subConn) bool {
+			return sc.md[registry.MetadataZone] == t.zone
+		})
+	}
+	next := atomic.AddUint32(&t.next, 1)
+	return candidates[int(next)%len(candidates)].sc, nil, nil
+}
@@ -0,0 +1,168 @@
+package dialer_test
+
+import (
+	"context"
+	"github.com/qeelyn/go-common/grpcx/dialer"
+	"github.com/qeelyn/go-common/grpcx/internal/mock"
+	"github.com/qeelyn/go-common/grpcx/internal/mock/prototest"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"github.com/qeelyn/go-common/grpcx/registry/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+	"net"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T) (*grpc.Server, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	prototest.RegisterSayServer(srv, &mock.Hello{})
+	go srv.Serve(lis)
+	return srv, lis.Addr().String()
+}
+
+func TestWithZone(t *testing.T) {
+	r := memory.NewRegistry()
+	resolver.Register(r)
+	nodes := map[string]map[string]string{
+		"a1": {registry.MetadataZone: "a", registry.MetadataVersion: "v1"},
+		"b1": {registry.MetadataZone: "b", registry.MetadataVersion: "v1"},
+		"b2": {registry.MetadataZone: "b", registry.MetadataVersion: "v2", registry.MetadataCanary: "true"},
+	}
+	addrs := make(map[string]string)
+	servers := make(map[string]*grpc.Server)
+	for id, md := range nodes {
+		srv, addr := startServer(t)
+		defer srv.Stop()
+		servers[id], addrs[addr] = srv, id
+		r.Register(mock.TestSvrName, &registry.Node{Id: id, Address: addr, Metadata: md})
+	}
+
+	conn, err := dialer.Dial(r.Scheme()+":///"+mock.TestSvrName,
+		dialer.WithDialOption(grpc.WithInsecure()), dialer.WithZone("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := prototest.NewSayClient(conn)
+	// try returns the node id which serves the request
+	try := func(ctx context.Context) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		var p peer.Peer
+		if _, err := client.Hello(ctx, &prototest.Request{}, grpc.FailFast(false), grpc.Peer(&p)); err != nil {
+			return "", err
+		}
+		return addrs[p.Addr.String()], nil
+	}
+	call := func(ctx context.Context) string {
+		id, err := try(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	// wait for all nodes ready
+	deadline := time.Now().Add(5 * time.Second)
+	for call(dialer.WithCanary(context.Background())) != "b2" && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		if id := call(context.Background()); id != "a1" {
+			t.Errorf("expect the node of the same zone, got %s", id)
+		}
+		if id := call(dialer.WithVersion(context.Background(), "v2")); id != "b2" {
+			t.Errorf("expect the node of v2, got %s", id)
+		}
+	}
+
+	// failover to the other zone except the canary,the requests on the closing node may fail
+	servers["a1"].Stop()
+	deadline = time.Now().Add(5 * time.Second)
+	id, err := try(context.Background())
+	for (err != nil || id == "a1") && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		id, err = try(context.Background())
+	}
+	if id != "b1" {
+		t.Errorf("expect failover to b1, got %s", id)
+	}
+}
+
+func TestWithRouting(t *testing.T) {
+	r := memory.NewRegistry()
+	resolver.Register(r)
+	nodes := map[string]map[string]string{
+		"v1":     {registry.MetadataVersion: "v1"},
+		"canary": {registry.MetadataVersion: "v2", registry.MetadataCanary: "true"},
+	}
+	addrs := make(map[string]string)
+	servers := make(map[string]*grpc.Server)
+	for id, md := range nodes {
+		srv, addr := startServer(t)
+		defer srv.Stop()
+		servers[id], addrs[addr] = srv, id
+		r.Register("routing", &registry.Node{Id: id, Address: addr, Metadata: md})
+	}
+
+	conn, err := dialer.Dial(r.Scheme()+":///routing", dialer.WithDialOption(grpc.WithInsecure()), dialer.WithRouting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := prototest.NewSayClient(conn)
+	try := func(ctx context.Context, failFast bool) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		var p peer.Peer
+		if _, err := client.Hello(ctx, &prototest.Request{}, grpc.FailFast(failFast), grpc.Peer(&p)); err != nil {
+			return "", err
+		}
+		return addrs[p.Addr.String()], nil
+	}
+	// wait for all nodes ready
+	if _, err := try(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for id, _ := try(dialer.WithCanary(context.Background()), false); id != "canary" && time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+		id, _ = try(dialer.WithCanary(context.Background()), false)
+	}
+	for i := 0; i < 5; i++ {
+		if id, err := try(context.Background(), true); id != "v1" {
+			t.Errorf("expect the node which is not canary, got %s %v", id, err)
+		}
+		if id, err := try(dialer.WithVersion(context.Background(), "v2"), true); id != "canary" {
+			t.Errorf("expect the node of v2, got %s %v", id, err)
+		}
+	}
+	if _, err := try(dialer.WithVersion(context.Background(), "v3"), true); status.Code(err) != codes.Unavailable {
+		t.Errorf("expect unavailable for the absent version, got %v", err)
+	}
+
+	// the requests without headers never reach the canary
+	servers["v1"].Stop()
+	deadline = time.Now().Add(5 * time.Second)
+	id, err := try(context.Background(), true)
+	for status.Code(err) != codes.Unavailable && time.Now().Before(deadline) {
+		if id == "canary" {
+			t.Fatal("the request without headers reaches the canary")
+		}
+		time.Sleep(50 * time.Millisecond)
+		id, err = try(context.Background(), true)
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expect unavailable without the stable nodes, got %s %v", id, err)
+	}
+	if id, err := try(dialer.WithCanary(context.Background()), true); id != "canary" {
+		t.Errorf("expect the canary, got %s %v", id, err)
+	}
+}
@@ -15,6 +15,10 @@ type Options struct {
 	UnaryClientInterceptors []grpc.UnaryClientInterceptor
 	DialOptions             []grpc.DialOption
 	TraceIdFunc             tracing.ClientTraceIdFunc
+	// Routing routes the requests by the version and canary metadata of the nodes
+	Routing bool
+	// Zone is the zone of the client which is preferred by the balancer
+	Zone string
 }
 
 type Option func(*Options)
@@ -59,8 +63,12 @@ func Dial(name string, opts ...Option) (*grpc.ClientConn, error) {
 	}
 
 	uopt := grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(options.UnaryClientInterceptors...))
+	dopts := append(options.DialOptions, uopt)
+	if options.Routing {
+		dopts = append(dopts, grpc.WithBalancerName(routingBalancerName(options.Zone)))
+	}
 
-	conn, err := grpc.Dial(name, append(options.DialOptions, uopt)...)
+	conn, err := grpc.Dial(name, dopts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial %s: %v", name, err)
 	}
@@ -0,0 +1,95 @@
+// Package election elects one active replica for the singleton tasks,such as schedulers or reconcilers.
+// The etcdv3 package elects by the etcd client of the registry,and Local elects in process for tests.
+// Example:
+//	e, err := etcdv3.NewElector(r, nodeId)
+//	l, err := e.Campaign(ctx, "scheduler")
+//	if err != nil {
+//		return err
+//	}
+//	defer l.Resign(context.Background())
+//	l.OnLost(func() {
+//		stopScheduler()
+//	})
+package election
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrNoLeader is returned by Leader when nobody is elected
+	ErrNoLeader = errors.New("election: no leader")
+	// ErrSessionLost is returned by Campaign when the session of the elector is lost
+	ErrSessionLost = errors.New("election: session is lost")
+)
+
+type Elector interface {
+	// Campaign blocks until the elector is elected as the leader of name or ctx is done
+	Campaign(ctx context.Context, name string) (Leadership, error)
+	// Leader returns the id of the current leader of name
+	Leader(ctx context.Context, name string) (string, error)
+	// Observe sends the id of the leader when it is changed until ctx is done,
+	// the id is empty if nobody is elected.
+	Observe(ctx context.Context, name string) <-chan string
+}
+
+// Leadership is held until it is resigned or lost,such as the session expiry after a network partition.
+type Leadership interface {
+	Name() string
+	// Done is closed when the leadership is resigned or lost
+	Done() <-chan struct{}
+	// OnLost calls fn when the leadership is lost but not resigned,fn is called at once if it is already lost.
+	OnLost(fn func())
+	// Resign gives up the leadership,another candidate will be elected.
+	Resign(ctx context.Context) error
+}
+
+// LeadershipState implements the Done and OnLost of Leadership
+type LeadershipState struct {
+	mu      sync.Mutex
+	done    chan struct{}
+	lost    bool
+	onLost  []func()
+	stopped bool
+}
+
+func NewLeadershipState() *LeadershipState {
+	return &LeadershipState{done: make(chan struct{})}
+}
+
+func (t *LeadershipState) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *LeadershipState) OnLost(fn func()) {
+	t.mu.Lock()
+	if !t.lost {
+		t.onLost = append(t.onLost, fn)
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+	fn()
+}
+
+// Stop closes Done and calls the OnLost callbacks if lost,it returns false if it has been stopped.
+func (t *LeadershipState) Stop(lost bool) bool {
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return false
+	}
+	t.stopped, t.lost = true, lost
+	fns := t.onLost
+	t.onLost = nil
+	close(t.done)
+	t.mu.Unlock()
+	if lost {
+		for _, fn := range fns {
+			fn()
+		}
+	}
+	return true
+}
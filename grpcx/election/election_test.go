@@ -0,0 +1,80 @@
+package election_test
+
+import (
+	"context"
+	"github.com/qeelyn/go-common/grpcx/election"
+	"testing"
+	"time"
+)
+
+func TestLocalElection(t *testing.T) {
+	local := election.NewLocal()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	observed := local.Elector("observer").Observe(ctx, "scheduler")
+	if id := <-observed; id != "" {
+		t.Fatalf("expect no leader, got %s", id)
+	}
+
+	l1, err := local.Elector("n1").Campaign(ctx, "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := <-observed; id != "n1" {
+		t.Errorf("observed leader: %s", id)
+	}
+	elected := make(chan election.Leadership)
+	go func() {
+		l, err := local.Elector("n2").Campaign(ctx, "scheduler")
+		if err != nil {
+			t.Error(err)
+		}
+		elected <- l
+	}()
+	go func() {
+		// n3 gives up
+		cctx, ccancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer ccancel()
+		if _, err := local.Elector("n3").Campaign(cctx, "scheduler"); err != context.DeadlineExceeded {
+			t.Errorf("expect deadline exceeded, got %v", err)
+		}
+	}()
+	select {
+	case <-elected:
+		t.Fatal("only one leader is allowed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if id, err := local.Elector("n3").Leader(ctx, "scheduler"); err != nil || id != "n1" {
+		t.Errorf("leader: %s, %v", id, err)
+	}
+
+	if err := l1.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	l2 := <-elected
+	if id := <-observed; id != "n2" {
+		t.Errorf("observed leader: %s", id)
+	}
+	select {
+	case <-l1.Done():
+	default:
+		t.Error("resigned leadership must be done")
+	}
+
+	lost := make(chan struct{})
+	l2.OnLost(func() {
+		close(lost)
+	})
+	local.Revoke("n2")
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("lost is not called")
+	}
+	if id := <-observed; id != "" {
+		t.Errorf("observed leader: %s", id)
+	}
+	if _, err := local.Elector("n3").Leader(ctx, "scheduler"); err != election.ErrNoLeader {
+		t.Errorf("expect no leader, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+// Package etcdv3 elects by the etcd client of the etcdv3 registry,each campaign has its own session
+// whose lease is kept alive,the leadership is lost when the session expires.
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/qeelyn/go-common/grpcx/election"
+	"github.com/qeelyn/go-common/grpcx/registry"
+)
+
+const (
+	// DefaultTTL is the session TTL without WithTTL
+	DefaultTTL = 10 * time.Second
+
+	keyPrefix  = "qeelyn-election"
+	retryDelay = time.Second
+)
+
+type etcdElector struct {
+	client *clientv3.Client
+	id     string
+	ttl    time.Duration
+}
+
+type Option func(*etcdElector)
+
+// WithTTL sets the session TTL,the leadership is lost after the elector is disconnected for the TTL.
+func WithTTL(ttl time.Duration) Option {
+	return func(e *etcdElector) {
+		e.ttl = ttl
+	}
+}
+
+// NewElector returns the elector of id which uses the client of the etcdv3 registry
+func NewElector(r registry.Registry, id string, opts ...Option) (election.Elector, error) {
+	client, ok := r.GetClient().(*clientv3.Client)
+	if !ok {
+		return nil, errors.New("election: the registry has no etcd client")
+	}
+	t := &etcdElector{client: client, id: id, ttl: DefaultTTL}
+	for _, o := range opts {
+		o(t)
+	}
+	if t.ttl < time.Second {
+		t.ttl = time.Second
+	}
+	return t, nil
+}
+
+func electionPath(name string) string {
+	return path.Join(keyPrefix, name)
+}
+
+func (t *etcdElector) Campaign(ctx context.Context, name string) (election.Leadership, error) {
+	s, err := concurrency.NewSession(t.client, concurrency.WithTTL(int(t.ttl/time.Second)))
+	if err != nil {
+		return nil, err
+	}
+	e := concurrency.NewElection(s, electionPath(name))
+	// the campaign is stopped if the session is lost while waiting
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.Done():
+			cancel()
+		case <-cctx.Done():
+		}
+	}()
+	err = e.Campaign(cctx, t.id)
+	select {
+	case <-s.Done():
+		err = election.ErrSessionLost
+	default:
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		s.Close()
+		return nil, err
+	}
+	l := &etcdLeadership{LeadershipState: election.NewLeadershipState(), name: name, session: s, election: e}
+	go func() {
+		<-s.Done()
+		if l.Stop(true) {
+			log.Printf("election: leadership of %s is lost", name)
+		}
+	}()
+	return l, nil
+}
+
+func (t *etcdElector) Leader(ctx context.Context, name string) (string, error) {
+	leader, _, err := t.leader(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if leader == "" {
+		return "", election.ErrNoLeader
+	}
+	return leader, nil
+}
+
+// leader returns the id of the leader and the revision of the response
+func (t *etcdElector) leader(ctx context.Context, name string) (string, int64, error) {
+	resp, err := t.client.Get(ctx, electionPath(name)+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", resp.Header.Revision, nil
+	}
+	return string(resp.Kvs[0].Value), resp.Header.Revision, nil
+}
+
+func (t *etcdElector) Observe(ctx context.Context, name string) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		last, first := "", true
+		for ctx.Err() == nil {
+			leader, rev, err := t.leader(ctx, name)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("election: observe %s: %s", name, err)
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryDelay):
+				}
+				continue
+			}
+			if first || leader != last {
+				select {
+				case ch <- leader:
+				case <-ctx.Done():
+					return
+				}
+				first, last = false, leader
+			}
+			// wait for any change of the candidates
+			wctx, cancel := context.WithCancel(ctx)
+			wch := t.client.Watch(wctx, electionPath(name)+"/", clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+			select {
+			case <-wch:
+			case <-ctx.Done():
+			}
+			cancel()
+		}
+	}()
+	return ch
+}
+
+type etcdLeadership struct {
+	*election.LeadershipState
+	name     string
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+func (t *etcdLeadership) Name() string {
+	return t.name
+}
+
+// Resign deletes the leader key and closes the session
+func (t *etcdLeadership) Resign(ctx context.Context) error {
+	t.Stop(false)
+	err := t.election.Resign(ctx)
+	if cerr := t.session.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package etcdv3_test
+
+import (
+	"context"
+	"github.com/qeelyn/go-common/grpcx/election/etcdv3"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	retcd "github.com/qeelyn/go-common/grpcx/registry/etcdv3"
+	"testing"
+	"time"
+)
+
+func TestCampaign(t *testing.T) {
+	r, err := retcd.NewRegistry(registry.Dsn("127.0.0.1:2379"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e1, err := etcdv3.NewElector(r, "n1", etcdv3.WithTTL(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2, _ := etcdv3.NewElector(r, "n2")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	l1, err := e1.Campaign(ctx, "election-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := e2.Leader(ctx, "election-test"); err != nil || id != "n1" {
+		t.Errorf("leader: %s, %v", id, err)
+	}
+	go l1.Resign(context.Background())
+	l2, err := e2.Campaign(ctx, "election-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2.Resign(ctx)
+}
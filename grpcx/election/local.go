@@ -0,0 +1,190 @@
+package election
+
+import (
+	"context"
+	"sync"
+)
+
+// Local elects the electors in process,the first candidate of a name is the leader.
+// Example:
+//	local := election.NewLocal()
+//	l, _ := local.Elector("n1").Campaign(ctx, "scheduler")
+//	go local.Elector("n2").Campaign(ctx, "scheduler") // blocks until n1 resigns or is revoked
+//	local.Revoke("n1")                                // n1 loses the leadership
+type Local struct {
+	mu sync.Mutex
+	// the candidates by name in campaign order
+	candidates map[string][]*localCandidate
+	observers  map[string][]chan struct{}
+}
+
+type localCandidate struct {
+	id      string
+	elected chan struct{}
+	state   *LeadershipState
+}
+
+func NewLocal() *Local {
+	return &Local{
+		candidates: make(map[string][]*localCandidate),
+		observers:  make(map[string][]chan struct{}),
+	}
+}
+
+// Elector returns the elector of the id
+func (t *Local) Elector(id string) Elector {
+	return &localElector{local: t, id: id}
+}
+
+// Revoke makes the elector of id lose all its leaderships and candidacies,like the expiry of its session
+func (t *Local) Revoke(id string) {
+	t.mu.Lock()
+	var lost []*localCandidate
+	for name, cs := range t.candidates {
+		for _, c := range cs {
+			if c.id == id {
+				lost = append(lost, c)
+				t.remove(name, c)
+			}
+		}
+	}
+	t.mu.Unlock()
+	for _, c := range lost {
+		c.state.Stop(true)
+	}
+}
+
+// remove deletes the candidate and elects the next one. The lock must be held.
+func (t *Local) remove(name string, c *localCandidate) {
+	cs := t.candidates[name]
+	for i := range cs {
+		if cs[i] != c {
+			continue
+		}
+		t.candidates[name] = append(cs[:i:i], cs[i+1:]...)
+		if i == 0 {
+			if len(t.candidates[name]) > 0 {
+				close(t.candidates[name][0].elected)
+			}
+			t.notify(name)
+		}
+		return
+	}
+}
+
+// notify wakes up the observers of name. The lock must be held.
+func (t *Local) notify(name string) {
+	for _, ch := range t.observers[name] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Local) leader(name string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cs := t.candidates[name]; len(cs) > 0 {
+		return cs[0].id
+	}
+	return ""
+}
+
+type localElector struct {
+	local *Local
+	id    string
+}
+
+func (t *localElector) Campaign(ctx context.Context, name string) (Leadership, error) {
+	c := &localCandidate{id: t.id, elected: make(chan struct{}), state: NewLeadershipState()}
+	t.local.mu.Lock()
+	t.local.candidates[name] = append(t.local.candidates[name], c)
+	if len(t.local.candidates[name]) == 1 {
+		close(c.elected)
+		t.local.notify(name)
+	}
+	t.local.mu.Unlock()
+	select {
+	case <-c.elected:
+		select {
+		case <-c.state.Done():
+			return nil, ErrSessionLost
+		default:
+		}
+		return &localLeadership{LeadershipState: c.state, local: t.local, name: name, c: c}, nil
+	case <-c.state.Done():
+		return nil, ErrSessionLost
+	case <-ctx.Done():
+		t.local.mu.Lock()
+		t.local.remove(name, c)
+		t.local.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (t *localElector) Leader(ctx context.Context, name string) (string, error) {
+	if id := t.local.leader(name); id != "" {
+		return id, nil
+	}
+	return "", ErrNoLeader
+}
+
+func (t *localElector) Observe(ctx context.Context, name string) <-chan string {
+	notify := make(chan struct{}, 1)
+	t.local.mu.Lock()
+	t.local.observers[name] = append(t.local.observers[name], notify)
+	t.local.mu.Unlock()
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		defer func() {
+			t.local.mu.Lock()
+			obs := t.local.observers[name]
+			for i := range obs {
+				if obs[i] == notify {
+					t.local.observers[name] = append(obs[:i:i], obs[i+1:]...)
+					break
+				}
+			}
+			t.local.mu.Unlock()
+		}()
+		last := ""
+		first := true
+		for {
+			if id := t.local.leader(name); first || id != last {
+				select {
+				case ch <- id:
+				case <-ctx.Done():
+					return
+				}
+				first, last = false, id
+			}
+			select {
+			case <-notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+type localLeadership struct {
+	*LeadershipState
+	local *Local
+	name  string
+	c     *localCandidate
+}
+
+func (t *localLeadership) Name() string {
+	return t.name
+}
+
+func (t *localLeadership) Resign(ctx context.Context) error {
+	t.local.mu.Lock()
+	t.local.remove(t.name, t.c)
+	t.local.mu.Unlock()
+	t.Stop(false)
+	return nil
+}
@@ -0,0 +1,194 @@
+package grpcx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const defaultHealthCheckInterval = 10 * time.Second
+
+// HealthCheck returns an error if the dependency is unhealthy
+type HealthCheck func(ctx context.Context) error
+
+type namedHealthCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// WithHealthCheck adds a health check which is run periodically after the server is serving,
+// the node is withdrawn from the registry while any check fails and registered again after all pass.
+// The state is also served by the grpc health service for the server name and the empty service name
+// which is checked by the standard probes.
+// Example:
+//	grpcx.WithHealthCheck("db", func(ctx context.Context) error {
+//		return db.DB().PingContext(ctx)
+//	})
+func WithHealthCheck(name string, check HealthCheck) Option {
+	return func(options *serverOptions) {
+		options.healthChecks = append(options.healthChecks, namedHealthCheck{name: name, check: check})
+	}
+}
+
+// WithHealthCheckInterval sets the interval of the health checks,each check must finish in the interval.
+func WithHealthCheckInterval(interval time.Duration) Option {
+	return func(options *serverOptions) {
+		options.healthCheckInterval = interval
+	}
+}
+
+// healthServer is the grpc health service which serves the overall status for the empty service name,
+// the health server of grpc always reports SERVING for it.
+type healthServer struct {
+	*health.Server
+	mu      sync.Mutex
+	overall grpc_health_v1.HealthCheckResponse_ServingStatus
+}
+
+func newHealthServer() *healthServer {
+	return &healthServer{Server: health.NewServer(), overall: grpc_health_v1.HealthCheckResponse_SERVING}
+}
+
+func (t *healthServer) Check(ctx context.Context, in *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if in.Service != "" {
+		return t.Server.Check(ctx, in)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &grpc_health_v1.HealthCheckResponse{Status: t.overall}, nil
+}
+
+// SetServingStatus sets the status of the service,the empty service is the overall status
+func (t *healthServer) SetServingStatus(service string, status grpc_health_v1.HealthCheckResponse_ServingStatus) {
+	if service != "" {
+		t.Server.SetServingStatus(service, status)
+		return
+	}
+	t.mu.Lock()
+	t.overall = status
+	t.mu.Unlock()
+}
+
+// healthKeeper keeps the registration and the grpc health status in line with the health checks,
+// the status is served for the server name and the empty name.
+type healthKeeper struct {
+	name       string
+	options    *serverOptions
+	node       *registry.Node
+	health     *healthServer
+	interval   time.Duration
+	healthy    bool
+	registered bool
+}
+
+func newHealthKeeper(name string, options *serverOptions, node *registry.Node, rpcSrv *grpc.Server) *healthKeeper {
+	t := &healthKeeper{name: name, options: options, node: node, interval: options.healthCheckInterval}
+	if t.interval <= 0 {
+		t.interval = defaultHealthCheckInterval
+	}
+	// the health service may be registered by the user
+	if _, ok := rpcSrv.GetServiceInfo()["grpc.health.v1.Health"]; !ok {
+		t.health = newHealthServer()
+		grpc_health_v1.RegisterHealthServer(rpcSrv, t.health)
+	}
+	return t
+}
+
+func (t *healthKeeper) setStatus(status grpc_health_v1.HealthCheckResponse_ServingStatus) {
+	t.health.SetServingStatus(t.name, status)
+	t.health.SetServingStatus("", status)
+}
+
+// check runs the health checks and returns the first error,each check must finish in the interval
+func (t *healthKeeper) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, t.interval)
+	defer cancel()
+	for _, c := range t.options.healthChecks {
+		if err := c.check(ctx); err != nil {
+			return fmt.Errorf("%s: %s", c.name, err)
+		}
+	}
+	return nil
+}
+
+// update runs the health checks and registers or withdraws the node if the health is changed,
+// nothing is changed if ctx is cancelled during the checks.
+func (t *healthKeeper) update(ctx context.Context) error {
+	err := t.check(ctx)
+	if ctx.Err() != nil {
+		return nil
+	}
+	healthy := err == nil
+	if healthy != t.healthy {
+		if healthy {
+			log.Printf("health checks passed")
+		} else {
+			log.Printf("health check failed: %s", err)
+		}
+	}
+	t.healthy = healthy
+	if t.health != nil {
+		status := grpc_health_v1.HealthCheckResponse_SERVING
+		if !healthy {
+			status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		}
+		t.setStatus(status)
+	}
+	if t.options.register == nil || healthy == t.registered {
+		return nil
+	}
+	if healthy {
+		if err := t.options.register.Register(t.options.registryServiceName, t.node); err != nil {
+			return err
+		}
+	} else if err := t.options.register.Unregister(t.options.registryServiceName, t.node); err != nil {
+		return err
+	}
+	t.registered = healthy
+	return nil
+}
+
+// run updates periodically until stop is closed,the node is unregistered and not serving at last.
+// The running checks are cancelled when stop is closed.
+func (t *healthKeeper) run(stop <-chan struct{}) {
+	if len(t.options.healthChecks) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+	loop:
+		for {
+			select {
+			case <-stop:
+				break loop
+			case <-ticker.C:
+				if err := t.update(ctx); err != nil {
+					log.Printf("failed to update the registration: %s", err)
+				}
+			}
+		}
+	} else {
+		<-stop
+	}
+	if t.health != nil {
+		t.setStatus(grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	}
+	if t.registered {
+		t.options.register.Unregister(t.options.registryServiceName, t.node)
+		t.registered = false
+	}
+}
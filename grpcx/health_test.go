@@ -0,0 +1,95 @@
+package grpcx_test
+
+import (
+	"context"
+	"errors"
+	"github.com/qeelyn/go-common/grpcx"
+	"github.com/qeelyn/go-common/grpcx/registry/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckedRegistration(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := lis.Addr().String()
+	lis.Close()
+
+	r := memory.NewRegistry()
+	var unhealthy int32
+	srv, err := grpcx.Micro("health", grpcx.WithRegistry(r, "health", listen),
+		grpcx.WithHealthCheck("db", func(ctx context.Context) error {
+			if atomic.LoadInt32(&unhealthy) == 1 {
+				return errors.New("db is down")
+			}
+			return nil
+		}),
+		grpcx.WithHealthCheckInterval(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpcSrv := srv.BuildGrpcServer()
+	stopped := make(chan error)
+	go func() {
+		stopped <- srv.Run(context.Background(), rpcSrv, listen)
+	}()
+
+	// registered waits until the registration is the expected state
+	registered := func(expect bool) {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			nodes, _ := r.GetService("health")
+			if (len(nodes) == 1) == expect {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expect registered %t, got %v", expect, nodes)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	registered(true)
+
+	conn, err := grpc.Dial(listen, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	status := func() grpc_health_v1.HealthCheckResponse_ServingStatus {
+		resp, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "health"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the standard probes check the empty service
+		overall, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if overall.Status != resp.Status {
+			t.Errorf("overall status %s, server status %s", overall.Status, resp.Status)
+		}
+		return resp.Status
+	}
+	if s := status(); s != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("status: %s", s)
+	}
+
+	atomic.StoreInt32(&unhealthy, 1)
+	registered(false)
+	if s := status(); s != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status: %s", s)
+	}
+	atomic.StoreInt32(&unhealthy, 0)
+	registered(true)
+
+	rpcSrv.Stop()
+	<-stopped
+	registered(false)
+}
@@ -67,5 +67,5 @@ func NewMicroServer(listen string) error {
 
 	arpc := a.BuildGrpcServer()
 	prototest.RegisterSayServer(arpc, &Hello{})
-	return a.Run(arpc, listen)
+	return a.Run(context.Background(), arpc, listen)
 }
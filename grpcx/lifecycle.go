@@ -0,0 +1,213 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	defaultDeregisterDelay = 5 * time.Second
+)
+
+// ErrNotRunning is returned by Shutdown if the server is not running
+var ErrNotRunning = errors.New("grpcx: server is not running")
+
+// WithShutdownTimeout sets the deadline of the shutdown triggered by the signals or the context of Run,
+// the remaining requests are cancelled after it.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(options *serverOptions) {
+		options.shutdownTimeout = timeout
+	}
+}
+
+// WithDeregisterDelay sets the delay between the deregistration and the stop of the server,
+// the clients keep sending requests until they receive the deregistration.
+func WithDeregisterDelay(delay time.Duration) Option {
+	return func(options *serverOptions) {
+		options.deregisterDelay = &delay
+	}
+}
+
+// lifecycle is the running state of the server
+type lifecycle struct {
+	mu      sync.Mutex
+	rpcSrv  *grpc.Server
+	metrics *http.Server
+	// stops the health keeper which deregisters the node,it is closed once
+	keeperStop    chan struct{}
+	keeperStopped bool
+	keeperDone    chan struct{}
+	// closed when the shutdown is finished
+	shutdownDone chan struct{}
+	shutdownErr  error
+}
+
+func (t *lifecycle) setMetrics(srv *http.Server) {
+	t.mu.Lock()
+	t.metrics = srv
+	t.mu.Unlock()
+}
+
+// stopKeeper stops the health keeper and waits until the node is deregistered or ctx is done
+func (t *lifecycle) stopKeeper(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.keeperStopped {
+		t.keeperStopped = true
+		close(t.keeperStop)
+	}
+	done := t.keeperDone
+	t.mu.Unlock()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stopped returns the done channel of the shutdown if it is started,
+// otherwise the server is marked as not running and its metrics server is returned to be closed.
+func (t *lifecycle) stopped() (chan struct{}, *http.Server) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.shutdownDone != nil {
+		return t.shutdownDone, nil
+	}
+	metrics := t.metrics
+	t.rpcSrv, t.metrics = nil, nil
+	return nil, metrics
+}
+
+// reset marks the server as not running after Run returns
+func (t *lifecycle) reset() {
+	t.mu.Lock()
+	t.rpcSrv, t.metrics = nil, nil
+	t.mu.Unlock()
+}
+
+// Shutdown stops the running server gracefully:
+// deregisters the node,waits the deregister delay,stops the grpc server gracefully until ctx is done,
+// stops the metrics server,and flushes the logger and the tracer.
+func (t Server) Shutdown(ctx context.Context) error {
+	l := &t.Option.lifecycle
+	l.mu.Lock()
+	if l.rpcSrv == nil {
+		l.mu.Unlock()
+		return ErrNotRunning
+	}
+	if done := l.shutdownDone; done != nil {
+		l.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return l.shutdownErr
+	}
+	l.shutdownDone = make(chan struct{})
+	rpcSrv, metrics := l.rpcSrv, l.metrics
+	l.mu.Unlock()
+
+	err := t.shutdown(ctx, rpcSrv, metrics)
+	l.mu.Lock()
+	l.shutdownErr = err
+	close(l.shutdownDone)
+	l.mu.Unlock()
+	return err
+}
+
+func (t Server) shutdown(ctx context.Context, rpcSrv *grpc.Server, metrics *http.Server) error {
+	l := &t.Option.lifecycle
+	log.Printf("%s is shutting down", t.Name)
+	if err := l.stopKeeper(ctx); err != nil {
+		log.Printf("%s: the node is not deregistered before the shutdown timeout", t.Name)
+	}
+
+	delay := defaultDeregisterDelay
+	if t.Option.deregisterDelay != nil {
+		delay = *t.Option.deregisterDelay
+	}
+	if t.Option.register != nil && delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	var err error
+	stopped := make(chan struct{})
+	go func() {
+		rpcSrv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Printf("%s: graceful stop is timeout, stop the remaining requests", t.Name)
+		rpcSrv.Stop()
+		<-stopped
+		err = ctx.Err()
+	}
+
+	if metrics != nil {
+		if merr := metrics.Shutdown(ctx); merr != nil {
+			metrics.Close()
+		}
+	}
+	if t.Option.logger != nil {
+		t.Option.logger.Sync()
+	}
+	if closer, ok := t.Option.tracer.(io.Closer); ok {
+		if cerr := closer.Close(); cerr != nil {
+			log.Printf("failed to close the tracer: %s", cerr)
+		}
+	}
+	return err
+}
+
+// waitShutdown shuts down the server when ctx is done or SIGTERM/SIGINT is received,
+// it returns when the server stops.
+func (t Server) waitShutdown(ctx context.Context, served <-chan error) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sig)
+
+	select {
+	case s := <-sig:
+		log.Printf("%s received %s", t.Name, s)
+	case <-ctx.Done():
+	case err := <-served:
+		// stopped by Shutdown or the grpc server directly
+		l := &t.Option.lifecycle
+		done, metrics := l.stopped()
+		if done != nil {
+			<-done
+			return l.shutdownErr
+		}
+		l.stopKeeper(context.Background())
+		if metrics != nil {
+			metrics.Close()
+		}
+		return err
+	}
+	timeout := t.Option.shutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := t.Shutdown(sctx)
+	<-served
+	return err
+}
@@ -0,0 +1,319 @@
+package grpcx_test
+
+import (
+	"context"
+	"github.com/opentracing/opentracing-go"
+	"github.com/qeelyn/go-common/grpcx"
+	"github.com/qeelyn/go-common/grpcx/registry/memory"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := lis.Addr().String()
+	lis.Close()
+
+	r := memory.NewRegistry()
+	srv, err := grpcx.Micro("lifecycle", grpcx.WithRegistry(r, "lifecycle", listen),
+		grpcx.WithDeregisterDelay(300*time.Millisecond),
+		grpcx.WithShutdownTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Shutdown(context.Background()); err != grpcx.ErrNotRunning {
+		t.Errorf("shutdown before run: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error)
+	go func() {
+		stopped <- srv.Run(ctx, srv.BuildGrpcServer(), listen)
+	}()
+
+	registered := func() bool {
+		nodes, _ := r.GetService("lifecycle")
+		return len(nodes) == 1
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !registered() {
+		if time.Now().After(deadline) {
+			t.Fatal("not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn, err := grpc.Dial(listen, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cancel()
+	deadline = time.Now().Add(time.Second)
+	for registered() {
+		if time.Now().After(deadline) {
+			t.Fatal("not deregistered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the server keeps serving during the deregister delay
+	if _, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Errorf("request during the deregister delay: %v", err)
+	}
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run is not returned")
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+// runServer runs the server of name until it is registered,the result of Run is sent to the returned channel
+func runServer(t *testing.T, ctx context.Context, name string, opts ...grpcx.Option) (*grpcx.Server, *grpc.Server, *memory.Registry, <-chan error) {
+	listen := freeAddr(t)
+	r := memory.NewRegistry()
+	opts = append(opts, grpcx.WithRegistry(r, name, listen), grpcx.WithDeregisterDelay(0))
+	srv, err := grpcx.Micro(name, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpcSrv := srv.BuildGrpcServer()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Run(ctx, rpcSrv, listen)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if nodes, _ := r.GetService(name); len(nodes) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return srv, rpcSrv, r, stopped
+}
+
+func waitRun(t *testing.T, stopped <-chan error) {
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run is not returned")
+	}
+}
+
+func TestShutdownAfterStop(t *testing.T) {
+	srv, rpcSrv, r, stopped := runServer(t, context.Background(), "stopped")
+	// stopped by the grpc server directly
+	rpcSrv.Stop()
+	waitRun(t, stopped)
+	if nodes, _ := r.GetService("stopped"); len(nodes) != 0 {
+		t.Error("not deregistered")
+	}
+	if err := srv.Shutdown(context.Background()); err != grpcx.ErrNotRunning {
+		t.Errorf("shutdown after stop: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv, _, _, stopped = runServer(t, ctx, "cancelled")
+	cancel()
+	waitRun(t, stopped)
+	if err := srv.Shutdown(context.Background()); err != grpcx.ErrNotRunning {
+		t.Errorf("shutdown after run returns: %v", err)
+	}
+}
+
+// syncer counts the syncs of the logger
+type syncer struct {
+	synced int32
+}
+
+func (t *syncer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (t *syncer) Sync() error {
+	atomic.AddInt32(&t.synced, 1)
+	return nil
+}
+
+type closingTracer struct {
+	opentracing.NoopTracer
+	closed int32
+}
+
+func (t *closingTracer) Close() error {
+	atomic.AddInt32(&t.closed, 1)
+	return nil
+}
+
+func TestShutdownFlush(t *testing.T) {
+	metricsListen := freeAddr(t)
+	ws := &syncer{}
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), ws, zap.InfoLevel))
+	tracer := &closingTracer{}
+	srv, _, _, stopped := runServer(t, context.Background(), "flush",
+		grpcx.WithPrometheus(metricsListen), grpcx.WithLogger(logger), grpcx.WithTracer(tracer))
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", metricsListen)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the metrics server is not serving")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitRun(t, stopped)
+	if conn, err := net.Dial("tcp", metricsListen); err == nil {
+		conn.Close()
+		t.Error("the metrics server is not shut down")
+	}
+	if atomic.LoadInt32(&ws.synced) == 0 {
+		t.Error("the logger is not synced")
+	}
+	if atomic.LoadInt32(&tracer.closed) != 1 {
+		t.Error("the tracer is not closed")
+	}
+}
+
+func TestShutdownBySignal(t *testing.T) {
+	// keeps the test process alive if the signal arrives before Run listens to it
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	srv, _, r, stopped := runServer(t, context.Background(), "signal")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		select {
+		case err := <-stopped:
+			if err != nil {
+				t.Errorf("run: %v", err)
+			}
+			if nodes, _ := r.GetService("signal"); len(nodes) != 0 {
+				t.Error("not deregistered")
+			}
+			if err := srv.Shutdown(context.Background()); err != grpcx.ErrNotRunning {
+				t.Errorf("shutdown after the signal: %v", err)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("run is not returned after SIGTERM")
+		}
+	}
+}
+
+func TestShutdownCancelsHealthCheck(t *testing.T) {
+	var calls int32
+	started := make(chan struct{}, 1)
+	cancelled := make(chan error, 1)
+	srv, _, r, stopped := runServer(t, context.Background(), "checking",
+		grpcx.WithHealthCheckInterval(2*time.Second),
+		grpcx.WithHealthCheck("slow", func(ctx context.Context) error {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return nil
+			}
+			started <- struct{}{}
+			<-ctx.Done()
+			cancelled <- ctx.Err()
+			return ctx.Err()
+		}))
+	// the second check runs after the interval until its context is done
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the health check is not run")
+	}
+	begin := time.Now()
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("shutdown waits for the health check %s", elapsed)
+	}
+	if err := <-cancelled; err != context.Canceled {
+		t.Errorf("the health check is not cancelled: %v", err)
+	}
+	waitRun(t, stopped)
+	if nodes, _ := r.GetService("checking"); len(nodes) != 0 {
+		t.Error("not deregistered")
+	}
+}
+
+func TestShutdownTimeoutWithHealthCheck(t *testing.T) {
+	var calls int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv, _, _, stopped := runServer(t, context.Background(), "stuck",
+		grpcx.WithHealthCheckInterval(200*time.Millisecond),
+		grpcx.WithHealthCheck("stuck", func(ctx context.Context) error {
+			if atomic.AddInt32(&calls, 1) == 2 {
+				// ignores ctx
+				started <- struct{}{}
+				<-release
+			}
+			return nil
+		}))
+	defer close(release)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the health check is not run")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expect the deadline error, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("shutdown ignores the timeout %s", elapsed)
+	}
+	release <- struct{}{}
+	select {
+	case err := <-stopped:
+		if err != context.DeadlineExceeded {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run is not returned")
+	}
+}
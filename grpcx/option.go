@@ -10,6 +10,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 )
 
 type serverOptions struct {
@@ -23,8 +24,14 @@ type serverOptions struct {
 	register                 registry.Registry
 	registryServiceName      string
 	RegistryListen           string
+	registryMetadata         map[string]string
 	recovery                 grpc_recovery.RecoveryHandlerFunc
 	grpcOptions              []grpc.ServerOption
+	healthChecks             []namedHealthCheck
+	healthCheckInterval      time.Duration
+	shutdownTimeout          time.Duration
+	deregisterDelay          *time.Duration
+	lifecycle                lifecycle
 }
 
 func (t *serverOptions) applyOption(opts ...Option) *serverOptions {
@@ -91,6 +98,20 @@ func WithRegistry(register registry.Registry, serviceName string, listen string)
 	}
 }
 
+// WithRegistryMetadata publishes the metadata of the node to the registry,such as version,zone or weight.
+// Example:
+//	grpcx.WithRegistryMetadata(map[string]string{registry.MetadataVersion: "v1.2.0", registry.MetadataZone: "hz-a"})
+func WithRegistryMetadata(md map[string]string) Option {
+	return func(options *serverOptions) {
+		if options.registryMetadata == nil {
+			options.registryMetadata = make(map[string]string)
+		}
+		for k, v := range md {
+			options.registryMetadata[k] = v
+		}
+	}
+}
+
 func WithGrpcOption(option grpc.ServerOption) Option {
 	return func(options *serverOptions) {
 		options.grpcOptions = append(options.grpcOptions, option)
@@ -0,0 +1,415 @@
+// Package consul provides the registry on the Consul agent,the nodes are registered as the services
+// of the agent with TTL checks,the metadata are saved as the service meta and the "key=value" tags.
+// The resolver and Watch follow the passing nodes by blocking queries.
+// The Dsn is the Consul HTTP API with options:
+//	127.0.0.1:8500?token=xxx&dc=dc1&wait=5m
+//	https://consul.local:8501
+// Example:
+//	r, err := consul.NewRegistry(registry.Dsn("127.0.0.1:8500"))
+//	resolver.Register(r.(resolver.Builder))
+//	conn, err := dialer.Dial(consul.Scheme+":///user", dialer.WithDialOption(grpc.WithInsecure()))
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qeelyn/go-common/grpcx/registry"
+)
+
+const (
+	// Scheme is the resolver scheme of the consul registry
+	Scheme = "consul"
+	// DefaultTTL is the TTL of the check without RegisterTTL
+	DefaultTTL = 10 * time.Second
+
+	defaultWait = 5 * time.Minute
+	// the critical services are removed by the agent after the duration
+	deregisterAfter = time.Minute
+	minRetryDelay   = 500 * time.Millisecond
+	maxRetryDelay   = 30 * time.Second
+)
+
+// errNotFound is returned by the agent when the service or check is not registered
+var errNotFound = errors.New("consul: not found")
+
+type consulRegistry struct {
+	options registry.Options
+	client  *http.Client
+	// base url of the api,such as http://127.0.0.1:8500
+	addr  string
+	token string
+	dc    string
+	// max wait of the blocking queries
+	wait time.Duration
+
+	mu sync.Mutex
+	// the registrations by the service id
+	registrations map[string]*registration
+}
+
+func NewRegistry(opts ...registry.Option) (registry.Registry, error) {
+	var options registry.Options
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Dsn == "" {
+		options.Dsn = "127.0.0.1:8500"
+	}
+	if options.Timeout == 0 {
+		options.Timeout = time.Minute
+	}
+	t := &consulRegistry{
+		options:       options,
+		client:        &http.Client{},
+		wait:          defaultWait,
+		registrations: make(map[string]*registration),
+	}
+	if options.TLSConfig != nil {
+		t.client.Transport = &http.Transport{TLSClientConfig: options.TLSConfig}
+	}
+	if err := t.parseDsn(options.Dsn); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *consulRegistry) parseDsn(dsn string) error {
+	if !strings.Contains(dsn, "://") {
+		dsn = "http://" + dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	t.token, t.dc = q.Get("token"), q.Get("dc")
+	if w := q.Get("wait"); w != "" {
+		if t.wait, err = time.ParseDuration(w); err != nil {
+			return fmt.Errorf("invalid wait %q: %s", w, err)
+		}
+	}
+	t.addr = u.Scheme + "://" + u.Host
+	return nil
+}
+
+// do sends the request to the api,the response body is decoded into out if it is not nil
+// and the index of the blocking query is returned.
+func (t *consulRegistry) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) (uint64, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if t.dc != "" {
+		query.Set("dc", t.dc)
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, t.addr+path+"?"+query.Encode(), body)
+	if err != nil {
+		return 0, err
+	}
+	if t.token != "" {
+		req.Header.Set("X-Consul-Token", t.token)
+	}
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return index, errNotFound
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return index, fmt.Errorf("consul: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	case out != nil:
+		return index, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return index, nil
+}
+
+// agentService is the service definition of the agent api
+type agentService struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Address string            `json:"Address,omitempty"`
+	Port    int               `json:"Port,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   *agentCheck       `json:"Check,omitempty"`
+}
+
+type agentCheck struct {
+	CheckID                        string `json:"CheckID"`
+	TTL                            string `json:"TTL"`
+	Status                         string `json:"Status"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+// serviceID returns the agent service id of the node
+func serviceID(serviceName, id string) string {
+	return serviceName + "-" + id
+}
+
+func checkID(serviceID string) string {
+	return "service:" + serviceID
+}
+
+// newAgentService converts the node to the service definition,the address without host is filled by the agent.
+func newAgentService(serviceName string, node *registry.Node, ttl time.Duration) (*agentService, error) {
+	host, port, err := net.SplitHostPort(node.Address)
+	if err != nil {
+		return nil, err
+	}
+	s := &agentService{
+		ID:      serviceID(serviceName, node.Id),
+		Name:    serviceName,
+		Address: host,
+		Meta:    node.Metadata,
+		Check: &agentCheck{
+			TTL:                            ttl.String(),
+			Status:                         "passing",
+			DeregisterCriticalServiceAfter: deregisterAfter.String(),
+		},
+	}
+	s.Check.CheckID = checkID(s.ID)
+	if s.Port, err = strconv.Atoi(port); err != nil {
+		return nil, fmt.Errorf("invalid port of %s", node.Address)
+	}
+	for k, v := range node.Metadata {
+		s.Tags = append(s.Tags, k+"="+v)
+	}
+	sort.Strings(s.Tags)
+	return s, nil
+}
+
+// Register registers the node to the agent with a TTL check which is passed until Unregister,
+// the node is registered again if the agent loses it,such as a restart of the agent.
+// The check TTL is DefaultTTL if RegisterTTL is not set.
+func (t *consulRegistry) Register(serviceName string, node *registry.Node, opts ...registry.RegisterOption) error {
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.TTL < time.Second {
+		options.TTL = DefaultTTL
+	}
+	s, err := newAgentService(serviceName, node, options.TTL)
+	if err != nil {
+		return err
+	}
+	reg := newRegistration(t, s, options.TTL)
+	if err := reg.register(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	old := t.registrations[s.ID]
+	t.registrations[s.ID] = reg
+	t.mu.Unlock()
+	if old != nil {
+		old.stop()
+	}
+	go reg.keepAlive()
+	return nil
+}
+
+// Unregister stops passing the check and deregisters the node from the agent
+func (t *consulRegistry) Unregister(serviceName string, node *registry.Node) error {
+	id := serviceID(serviceName, node.Id)
+	t.mu.Lock()
+	reg := t.registrations[id]
+	delete(t.registrations, id)
+	t.mu.Unlock()
+	if reg != nil {
+		reg.stop()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.options.Timeout)
+	defer cancel()
+	_, err := t.do(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(id), nil, nil, nil)
+	if err == errNotFound {
+		return nil
+	}
+	return err
+}
+
+// healthService is the entry of the health api
+type healthService struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string            `json:"ID"`
+		Service string            `json:"Service"`
+		Tags    []string          `json:"Tags"`
+		Address string            `json:"Address"`
+		Port    int               `json:"Port"`
+		Meta    map[string]string `json:"Meta"`
+	} `json:"Service"`
+}
+
+// node converts the entry to the node,the metadata are read from the tags if the meta is empty.
+func (t healthService) node() *registry.Node {
+	host := t.Service.Address
+	if host == "" {
+		host = t.Node.Address
+	}
+	node := &registry.Node{
+		Id:      strings.TrimPrefix(t.Service.ID, t.Service.Service+"-"),
+		Address: net.JoinHostPort(host, strconv.Itoa(t.Service.Port)),
+	}
+	if len(t.Service.Meta) > 0 {
+		node.Metadata = t.Service.Meta
+		return node
+	}
+	for _, tag := range t.Service.Tags {
+		if kv := strings.SplitN(tag, "=", 2); len(kv) == 2 {
+			if node.Metadata == nil {
+				node.Metadata = make(map[string]string)
+			}
+			node.Metadata[kv[0]] = kv[1]
+		}
+	}
+	return node
+}
+
+// query returns the passing nodes of the service sorted by id,it blocks until a change after index if index > 0
+func (t *consulRegistry) query(ctx context.Context, serviceName string, index uint64) ([]*registry.Node, uint64, error) {
+	query := url.Values{"passing": {"1"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", t.wait.String())
+	}
+	var entries []healthService
+	newIndex, err := t.do(ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(serviceName), query, nil, &entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	nodes := make([]*registry.Node, 0, len(entries))
+	for _, e := range entries {
+		nodes = append(nodes, e.node())
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Id < nodes[j].Id
+	})
+	return nodes, newIndex, nil
+}
+
+// GetService returns the passing nodes of the service
+func (t *consulRegistry) GetService(serviceName string) ([]*registry.Node, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.options.Timeout)
+	defer cancel()
+	nodes, _, err := t.query(ctx, serviceName, 0)
+	return nodes, err
+}
+
+// ListServices returns the services of the catalog except consul itself
+func (t *consulRegistry) ListServices() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.options.Timeout)
+	defer cancel()
+	var catalog map[string][]string
+	if _, err := t.do(ctx, http.MethodGet, "/v1/catalog/services", nil, nil, &catalog); err != nil {
+		return nil, err
+	}
+	services := make([]string, 0, len(catalog))
+	for name := range catalog {
+		if name != "consul" {
+			services = append(services, name)
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// GetClient returns the http client of the api
+func (t *consulRegistry) GetClient() interface{} {
+	return t.client
+}
+
+// registration passes the TTL check of a node
+type registration struct {
+	r       *consulRegistry
+	service *agentService
+	ttl     time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newRegistration(r *consulRegistry, service *agentService, ttl time.Duration) *registration {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &registration{r: r, service: service, ttl: ttl, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+}
+
+func (t *registration) register() error {
+	ctx, cancel := context.WithTimeout(t.ctx, t.r.options.Timeout)
+	defer cancel()
+	_, err := t.r.do(ctx, http.MethodPut, "/v1/agent/service/register", nil, t.service, nil)
+	return err
+}
+
+func (t *registration) pass() error {
+	ctx, cancel := context.WithTimeout(t.ctx, t.r.options.Timeout)
+	defer cancel()
+	_, err := t.r.do(ctx, http.MethodPut, "/v1/agent/check/pass/"+url.PathEscape(t.service.Check.CheckID), nil, nil, nil)
+	return err
+}
+
+// keepAlive passes the check 3 times per TTL until stopped,and registers again if the check is lost
+func (t *registration) keepAlive() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.ttl / 3)
+	defer ticker.Stop()
+	delay := minRetryDelay
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := t.pass()
+		if err == errNotFound {
+			log.Printf("registry: check of %s is lost, register again", t.service.ID)
+			err = t.register()
+		}
+		if err == nil || t.ctx.Err() != nil {
+			delay = minRetryDelay
+			continue
+		}
+		log.Printf("registry: failed to pass the check of %s: %s", t.service.ID, err)
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (t *registration) stop() {
+	t.cancel()
+	<-t.done
+}
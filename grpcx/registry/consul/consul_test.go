@@ -0,0 +1,250 @@
+package consul_test
+
+import (
+	"encoding/json"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"github.com/qeelyn/go-common/grpcx/registry/consul"
+	"google.golang.org/grpc/resolver"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type service struct {
+	ID      string
+	Name    string
+	Tags    []string
+	Address string
+	Port    int
+	Meta    map[string]string
+	Check   struct {
+		CheckID string
+		TTL     string
+	}
+	passed time.Time
+}
+
+// agent is a stand-in of the Consul agent,health and catalog api
+type agent struct {
+	mu       sync.Mutex
+	index    uint64
+	services map[string]*service
+	changed  chan struct{}
+	token    string
+}
+
+func newAgent() *agent {
+	return &agent{index: 1, services: make(map[string]*service), changed: make(chan struct{})}
+}
+
+// change must be called with the lock
+func (t *agent) change() {
+	t.index++
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+func (t *agent) forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.services, id)
+	t.change()
+}
+
+func (t *agent) has(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.services[id]
+	return ok
+}
+
+func (t *agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t.token != "" && r.Header.Get("X-Consul-Token") != t.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	p := r.URL.Path
+	switch {
+	case p == "/v1/agent/service/register":
+		s := &service{}
+		if err := json.NewDecoder(r.Body).Decode(s); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.passed = time.Now()
+		t.mu.Lock()
+		t.services[s.ID] = s
+		t.change()
+		t.mu.Unlock()
+	case strings.HasPrefix(p, "/v1/agent/service/deregister/"):
+		t.forget(strings.TrimPrefix(p, "/v1/agent/service/deregister/"))
+	case strings.HasPrefix(p, "/v1/agent/check/pass/"):
+		id := strings.TrimPrefix(p, "/v1/agent/check/pass/service:")
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		s, ok := t.services[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.passed = time.Now()
+	case p == "/v1/catalog/services":
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		catalog := map[string][]string{"consul": {}}
+		for _, s := range t.services {
+			catalog[s.Name] = append(catalog[s.Name], s.Tags...)
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(t.index, 10))
+		json.NewEncoder(w).Encode(catalog)
+	case strings.HasPrefix(p, "/v1/health/service/"):
+		name := strings.TrimPrefix(p, "/v1/health/service/")
+		q := r.URL.Query()
+		t.mu.Lock()
+		if idx, _ := strconv.ParseUint(q.Get("index"), 10, 64); idx > 0 && idx >= t.index {
+			changed := t.changed
+			t.mu.Unlock()
+			wait, _ := time.ParseDuration(q.Get("wait"))
+			select {
+			case <-changed:
+			case <-time.After(wait):
+			case <-r.Context().Done():
+				return
+			}
+			t.mu.Lock()
+		}
+		defer t.mu.Unlock()
+		entries := []map[string]interface{}{}
+		for _, s := range t.services {
+			ttl, _ := time.ParseDuration(s.Check.TTL)
+			if s.Name != name || time.Since(s.passed) > ttl {
+				continue
+			}
+			entries = append(entries, map[string]interface{}{
+				"Node":    map[string]string{"Address": "10.0.0.9"},
+				"Service": map[string]interface{}{"ID": s.ID, "Service": s.Name, "Tags": s.Tags, "Address": s.Address, "Port": s.Port, "Meta": s.Meta},
+			})
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(t.index, 10))
+		json.NewEncoder(w).Encode(entries)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+type clientConn struct {
+	addrs chan []resolver.Address
+}
+
+func (t *clientConn) NewAddress(addrs []resolver.Address) {
+	t.addrs <- addrs
+}
+
+func (t *clientConn) NewServiceConfig(string) {}
+
+func newRegistry(t *testing.T) (registry.Registry, *agent, func()) {
+	a := newAgent()
+	a.token = "secret"
+	srv := httptest.NewServer(a)
+	r, err := consul.NewRegistry(registry.Dsn(srv.URL + "?token=secret&wait=1s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, a, srv.Close
+}
+
+func TestConsulRegistry(t *testing.T) {
+	r, a, closeFn := newRegistry(t)
+	defer closeFn()
+
+	n1 := &registry.Node{Id: "n1", Address: "10.0.0.1:9000", Metadata: map[string]string{registry.MetadataZone: "a"}}
+	if err := r.Register("user", n1, registry.RegisterTTL(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Unregister("user", n1)
+	w, err := r.Watch("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	n2 := &registry.Node{Id: "n2", Address: ":9001"}
+	if err := r.Register("user", n2); err != nil {
+		t.Fatal(err)
+	}
+	ev, err := w.Next()
+	if err != nil || ev.Type != registry.EventCreate || ev.Node.Id != "n2" || ev.Node.Address != "10.0.0.9:9001" {
+		t.Fatalf("event: %+v, %v", ev, err)
+	}
+	nodes, err := r.GetService("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].Address != "10.0.0.1:9000" || nodes[0].Metadata[registry.MetadataZone] != "a" {
+		t.Errorf("nodes: %+v", nodes)
+	}
+	services, err := r.ListServices()
+	if err != nil || len(services) != 1 || services[0] != "user" {
+		t.Errorf("services: %v, %v", services, err)
+	}
+	if err := r.Unregister("user", n2); err != nil {
+		t.Fatal(err)
+	}
+	if ev, err = w.Next(); err != nil || ev.Type != registry.EventDelete || ev.Node.Id != "n2" {
+		t.Errorf("event: %+v, %v", ev, err)
+	}
+
+	// the agent loses the service
+	a.forget("user-n1")
+	deadline := time.Now().Add(5 * time.Second)
+	for !a.has("user-n1") {
+		if time.Now().After(deadline) {
+			t.Fatal("node is not registered again")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestConsulResolver(t *testing.T) {
+	r, _, closeFn := newRegistry(t)
+	defer closeFn()
+
+	cc := &clientConn{addrs: make(chan []resolver.Address, 10)}
+	rs, err := r.(resolver.Builder).Build(resolver.Target{Endpoint: "order"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	next := func() []resolver.Address {
+		select {
+		case addrs := <-cc.addrs:
+			return addrs
+		case <-time.After(5 * time.Second):
+			t.Fatal("addresses are not resolved")
+		}
+		return nil
+	}
+	if addrs := next(); len(addrs) != 0 {
+		t.Errorf("addrs: %v", addrs)
+	}
+	node := &registry.Node{Id: "n1", Address: "10.0.0.1:9000", Metadata: map[string]string{registry.MetadataVersion: "v1"}}
+	r.Register("order", node)
+	addrs := next()
+	if len(addrs) != 1 || addrs[0].Addr != "10.0.0.1:9000" || registry.AddressMetadata(addrs[0])[registry.MetadataVersion] != "v1" {
+		t.Errorf("addrs: %v", addrs)
+	}
+	// the drained node is not resolved
+	drained := &registry.Node{Id: "n2", Address: "10.0.0.2:9000", Metadata: map[string]string{registry.MetadataDrained: "true"}}
+	r.Register("order", drained)
+	if addrs := next(); len(addrs) != 1 || addrs[0].Addr != "10.0.0.1:9000" {
+		t.Errorf("addrs: %v", addrs)
+	}
+	r.Unregister("order", drained)
+	r.Unregister("order", node)
+	for addrs := next(); len(addrs) != 0; addrs = next() {
+	}
+}
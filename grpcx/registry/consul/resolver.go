@@ -0,0 +1,207 @@
+package consul
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"google.golang.org/grpc/resolver"
+)
+
+// errorReporter is implemented by the ClientConn of the grpc versions which accept resolver errors
+type errorReporter interface {
+	ReportError(error)
+}
+
+// nextIndex returns the index of the next blocking query,the index must be reset if it goes backwards.
+func nextIndex(old, new uint64) uint64 {
+	if new < old {
+		return 0
+	}
+	return new
+}
+
+// sleep waits for d,it returns false if ctx is done
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// Watch watches the passing nodes of the service from now on
+func (t *consulRegistry) Watch(serviceName string) (registry.Watcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	nodes, index, err := t.query(ctx, serviceName, 0)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	w := &consulWatcher{
+		r:       t,
+		service: serviceName,
+		ctx:     ctx,
+		cancel:  cancel,
+		index:   index,
+		nodes:   make(map[string]*registry.Node, len(nodes)),
+	}
+	for _, n := range nodes {
+		w.nodes[n.Id] = n
+	}
+	return w, nil
+}
+
+type consulWatcher struct {
+	r       *consulRegistry
+	service string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	index   uint64
+	// the last nodes by id
+	nodes map[string]*registry.Node
+	// the events of the last query which are not returned
+	pending []*registry.Event
+}
+
+func (t *consulWatcher) Next() (*registry.Event, error) {
+	for len(t.pending) == 0 {
+		nodes, index, err := t.r.query(t.ctx, t.service, t.index)
+		if t.ctx.Err() != nil {
+			return nil, registry.ErrWatcherStopped
+		}
+		if err != nil {
+			sleep(t.ctx, minRetryDelay)
+			return nil, err
+		}
+		if t.index = nextIndex(t.index, index); t.index == 0 && !sleep(t.ctx, minRetryDelay) {
+			return nil, registry.ErrWatcherStopped
+		}
+		t.diff(nodes)
+	}
+	e := t.pending[0]
+	t.pending = t.pending[1:]
+	return e, nil
+}
+
+// diff replaces the nodes and queues the changes
+func (t *consulWatcher) diff(nodes []*registry.Node) {
+	current := make(map[string]*registry.Node, len(nodes))
+	for _, n := range nodes {
+		current[n.Id] = n
+		old, ok := t.nodes[n.Id]
+		switch {
+		case !ok:
+			t.pending = append(t.pending, &registry.Event{Type: registry.EventCreate, Service: t.service, Node: n})
+		case !reflect.DeepEqual(old, n):
+			t.pending = append(t.pending, &registry.Event{Type: registry.EventUpdate, Service: t.service, Node: n})
+		}
+	}
+	for id, n := range t.nodes {
+		if _, ok := current[id]; !ok {
+			t.pending = append(t.pending, &registry.Event{Type: registry.EventDelete, Service: t.service, Node: n})
+		}
+	}
+	t.nodes = current
+}
+
+func (t *consulWatcher) Stop() {
+	t.cancel()
+}
+
+func (t *consulRegistry) Scheme() string {
+	return Scheme
+}
+
+// Build starts a resolver for the service of the target endpoint which follows the passing nodes
+func (t *consulRegistry) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &consulResolver{
+		r:          t,
+		service:    target.Endpoint,
+		cc:         cc,
+		ctx:        ctx,
+		cancel:     cancel,
+		resolveNow: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+type consulResolver struct {
+	r       *consulRegistry
+	service string
+	cc      resolver.ClientConn
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	resolveNow chan struct{}
+	done       chan struct{}
+}
+
+// ResolveNow retries at once if the last query is failed,the blocking query keeps the nodes up to date.
+func (t *consulResolver) ResolveNow(resolver.ResolveNowOption) {
+	select {
+	case t.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (t *consulResolver) Close() {
+	t.cancel()
+	<-t.done
+}
+
+func (t *consulResolver) run() {
+	defer close(t.done)
+	var (
+		index uint64
+		last  []*registry.Node
+		sent  bool
+	)
+	delay := minRetryDelay
+	for {
+		nodes, idx, err := t.r.query(t.ctx, t.service, index)
+		if t.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			t.reportError(err)
+			select {
+			case <-t.ctx.Done():
+				return
+			case <-t.resolveNow:
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+			continue
+		}
+		delay = minRetryDelay
+		if !sent || !reflect.DeepEqual(last, nodes) {
+			addrs := make([]resolver.Address, 0, len(nodes))
+			for _, n := range nodes {
+				if !n.Drained() {
+					addrs = append(addrs, n.ResolverAddress())
+				}
+			}
+			t.cc.NewAddress(addrs)
+			last, sent = nodes, true
+		}
+		if index = nextIndex(index, idx); index == 0 && !sleep(t.ctx, minRetryDelay) {
+			return
+		}
+	}
+}
+
+func (t *consulResolver) reportError(err error) {
+	log.Printf("registry: resolve %s: %s", t.service, err)
+	if r, ok := t.cc.(errorReporter); ok {
+		r.ReportError(err)
+	}
+}
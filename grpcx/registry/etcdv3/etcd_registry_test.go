@@ -90,3 +90,88 @@ func TestMulti(t *testing.T) {
 		<-time.After(time.Second)
 	}
 }
+
+func TestEtcdv3Registry_Watch(t *testing.T) {
+	r, err := etcdv3.NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Watch("watch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	node := &registry.Node{Id: "n1", Address: ":12350", Metadata: map[string]string{registry.MetadataZone: "a"}}
+	if err = r.Register("watch-test", node); err != nil {
+		t.Fatal(err)
+	}
+	ev, err := w.Next()
+	if err != nil || ev.Type != registry.EventCreate || ev.Node.Metadata[registry.MetadataZone] != "a" {
+		t.Fatalf("event: %+v, %v", ev, err)
+	}
+	nodes, err := r.GetService("watch-test")
+	if err != nil || len(nodes) != 1 || nodes[0].Address != ":12350" {
+		t.Errorf("nodes: %v, %v", nodes, err)
+	}
+	services, err := r.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(services)
+	if err = r.Unregister("watch-test", node); err != nil {
+		t.Fatal(err)
+	}
+	if ev, err = w.Next(); err != nil || ev.Type != registry.EventDelete || ev.Node.Id != "n1" {
+		t.Errorf("event: %+v, %v", ev, err)
+	}
+}
+
+type clientConn struct {
+	addrs chan []resolver.Address
+}
+
+func (t *clientConn) NewAddress(addrs []resolver.Address) {
+	t.addrs <- addrs
+}
+
+func (t *clientConn) NewServiceConfig(string) {}
+
+func TestEtcdv3Registry_Resolver(t *testing.T) {
+	r, err := etcdv3.NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &clientConn{addrs: make(chan []resolver.Address, 10)}
+	rs, err := r.(resolver.Builder).Build(resolver.Target{Endpoint: "resolver-test"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	<-cc.addrs
+	node := &registry.Node{Id: "n1", Address: ":12351"}
+	r.Register("resolver-test", node)
+	if addrs := <-cc.addrs; len(addrs) != 1 || addrs[0].Addr != ":12351" {
+		t.Errorf("addrs: %v", addrs)
+	}
+	// the changed value of the same key
+	node.Address = ":12352"
+	r.Register("resolver-test", node)
+	if addrs := <-cc.addrs; len(addrs) != 1 || addrs[0].Addr != ":12352" {
+		t.Errorf("addrs: %v", addrs)
+	}
+	// the drained node is removed from the addresses
+	node.Metadata = map[string]string{registry.MetadataDrained: "true"}
+	r.Register("resolver-test", node)
+	if addrs := <-cc.addrs; len(addrs) != 0 {
+		t.Errorf("the drained node is resolved: %v", addrs)
+	}
+	node.Metadata = nil
+	r.Register("resolver-test", node)
+	if addrs := <-cc.addrs; len(addrs) != 1 {
+		t.Errorf("the undrained node is not resolved: %v", addrs)
+	}
+	r.Unregister("resolver-test", node)
+	if addrs := <-cc.addrs; len(addrs) != 0 {
+		t.Errorf("addrs: %v", addrs)
+	}
+}
@@ -0,0 +1,119 @@
+package etcdv3
+
+import (
+	"context"
+	"github.com/coreos/etcd/clientv3"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTTL is the lease TTL of the registration without RegisterTTL
+	DefaultTTL = 10 * time.Second
+
+	minRetryDelay = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+// registration keeps the lease of a node alive,and registers the node again if the lease is lost
+type registration struct {
+	r     *etcdv3Registry
+	key   string
+	value string
+	ttl   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	leaseID clientv3.LeaseID
+}
+
+func newRegistration(r *etcdv3Registry, key, value string, ttl time.Duration) *registration {
+	// the registration is stopped with the client
+	ctx, cancel := context.WithCancel(r.client.Ctx())
+	return &registration{
+		r:      r,
+		key:    key,
+		value:  value,
+		ttl:    ttl,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// register grants a new lease and puts the node with it
+func (t *registration) register() error {
+	ctx, cancel := context.WithTimeout(t.ctx, t.r.options.Timeout)
+	defer cancel()
+	lgr, err := t.r.client.Grant(ctx, int64(t.ttl/time.Second))
+	if err != nil {
+		return err
+	}
+	if _, err = t.r.client.Put(ctx, t.key, t.value, clientv3.WithLease(lgr.ID)); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.leaseID = lgr.ID
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *registration) lease() clientv3.LeaseID {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.leaseID
+}
+
+// keepAlive keeps the lease alive until stopped or the client is closed,the keep alive channel is closed when
+// the lease is expired or revoked,then the node is registered with a new lease.
+func (t *registration) keepAlive() {
+	defer close(t.done)
+	for {
+		ch, err := t.r.client.KeepAlive(t.ctx, t.lease())
+		if err == nil {
+			for range ch {
+			}
+		}
+		if t.ctx.Err() != nil {
+			return
+		}
+		if _, ok := err.(clientv3.ErrKeepAliveHalted); ok || err == context.Canceled {
+			log.Printf("registry: stop keeping %s alive: %s", t.key, err)
+			return
+		}
+		log.Printf("registry: lease of %s is lost, register again", t.key)
+		delay := minRetryDelay
+		for {
+			if err = t.register(); err == nil {
+				break
+			}
+			log.Printf("registry: failed to register %s: %s", t.key, err)
+			select {
+			case <-t.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+		}
+	}
+}
+
+// stop stops keeping alive,the lease is revoked if revoke is true
+func (t *registration) stop(revoke bool) {
+	t.cancel()
+	<-t.done
+	if !revoke {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.r.options.Timeout)
+	defer cancel()
+	if _, err := t.r.client.Revoke(ctx, t.lease()); err != nil {
+		log.Printf("registry: failed to revoke the lease of %s: %s", t.key, err)
+	}
+}
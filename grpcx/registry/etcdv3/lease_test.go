@@ -0,0 +1,27 @@
+package etcdv3
+
+import (
+	"github.com/coreos/etcd/clientv3"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveStopsWithClient(t *testing.T) {
+	// the endpoint is never reachable,the lease is lost and the node is registered again until the client is closed
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{"127.0.0.1:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &etcdv3Registry{client: client, options: registry.Options{Timeout: 100 * time.Millisecond},
+		registrations: make(map[string]*registration)}
+	reg := newRegistration(r, NodePath("lease", "1"), "", DefaultTTL)
+	go reg.keepAlive()
+	time.Sleep(200 * time.Millisecond)
+	client.Close()
+	select {
+	case <-reg.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("keep alive is not stopped after the client is closed")
+	}
+}
@@ -0,0 +1,229 @@
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"google.golang.org/grpc/resolver"
+)
+
+// the minimal interval between the lists which are triggered by ResolveNow
+const resolveNowInterval = time.Second
+
+var errWatchClosed = errors.New("registry: watch channel is closed")
+
+// errorReporter is implemented by the ClientConn of the grpc versions which accept resolver errors
+type errorReporter interface {
+	ReportError(error)
+}
+
+// Build starts a resolver for the service of the target endpoint,each target has its own watch
+// which is stopped by Close.
+func (t *etcdv3Registry) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &etcdResolver{
+		client:     t.client,
+		timeout:    t.options.Timeout,
+		prefix:     ServicePath(target.Endpoint) + "/",
+		cc:         cc,
+		ctx:        ctx,
+		cancel:     cancel,
+		resolveNow: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+func (t *etcdv3Registry) Scheme() string {
+	return SCHEMA
+}
+
+type etcdResolver struct {
+	client  *clientv3.Client
+	timeout time.Duration
+	prefix  string
+	cc      resolver.ClientConn
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	resolveNow chan struct{}
+	done       chan struct{}
+
+	// the resolved addresses by key
+	addrs map[string]resolver.Address
+}
+
+// ResolveNow lists the nodes again
+func (t *etcdResolver) ResolveNow(resolver.ResolveNowOption) {
+	select {
+	case t.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the watch of the target
+func (t *etcdResolver) Close() {
+	t.cancel()
+	<-t.done
+}
+
+// run lists the nodes and watches the changes from the listed revision,it lists again when the watch
+// is compacted or ResolveNow is called,and retries with backoff after errors.
+func (t *etcdResolver) run() {
+	defer close(t.done)
+	delay := minRetryDelay
+	for {
+		listedAt := time.Now()
+		rev, err := t.list()
+		if err == nil {
+			err = t.watch(rev)
+		}
+		if t.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			delay = minRetryDelay
+			// avoid listing too often when ResolveNow is called by each failed connection
+			if wait := resolveNowInterval - time.Since(listedAt); wait > 0 {
+				select {
+				case <-t.ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+			continue
+		}
+		t.reportError(err)
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-t.resolveNow:
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (t *etcdResolver) reportError(err error) {
+	log.Printf("registry: resolve %s: %s", t.prefix, err)
+	if r, ok := t.cc.(errorReporter); ok {
+		r.ReportError(err)
+	}
+}
+
+// list replaces the addresses with the nodes in etcd and returns the revision
+func (t *etcdResolver) list() (int64, error) {
+	ctx, cancel := context.WithTimeout(t.ctx, t.timeout)
+	defer cancel()
+	resp, err := t.client.Get(ctx, t.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	addrs := make(map[string]resolver.Address, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if addr, ok := decodeAddress(string(kv.Key), kv.Value); ok {
+			addrs[string(kv.Key)] = addr
+		}
+	}
+	if t.addrs == nil || !reflect.DeepEqual(t.addrs, addrs) {
+		t.addrs = addrs
+		t.update()
+	}
+	return resp.Header.Revision, nil
+}
+
+// watch applies the changes after rev until ResolveNow is called or the watch is compacted
+func (t *etcdResolver) watch(rev int64) error {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	ch := t.client.Watch(ctx, t.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+	for {
+		select {
+		case <-t.resolveNow:
+			return nil
+		case resp, ok := <-ch:
+			if !ok {
+				return errWatchClosed
+			}
+			if resp.CompactRevision != 0 {
+				log.Printf("registry: watch %s is compacted at %d, list again", t.prefix, resp.CompactRevision)
+				return nil
+			}
+			if err := resp.Err(); err != nil {
+				return err
+			}
+			if t.apply(resp.Events) {
+				t.update()
+			}
+		}
+	}
+}
+
+// apply returns true if the addresses are changed
+func (t *etcdResolver) apply(events []*clientv3.Event) bool {
+	changed := false
+	for _, ev := range events {
+		key := string(ev.Kv.Key)
+		switch ev.Type {
+		case mvccpb.PUT:
+			addr, ok := decodeAddress(key, ev.Kv.Value)
+			if !ok {
+				// the node is drained or invalid
+				if _, exists := t.addrs[key]; exists {
+					delete(t.addrs, key)
+					changed = true
+				}
+				continue
+			}
+			// the address or metadata of a registered node may be changed
+			if old, exists := t.addrs[key]; !exists || !reflect.DeepEqual(old, addr) {
+				t.addrs[key] = addr
+				changed = true
+			}
+		case mvccpb.DELETE:
+			if _, ok := t.addrs[key]; ok {
+				delete(t.addrs, key)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// update sends the addresses sorted by key
+func (t *etcdResolver) update() {
+	keys := make([]string, 0, len(t.addrs))
+	for k := range t.addrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	addrs := make([]resolver.Address, 0, len(keys))
+	for _, k := range keys {
+		addrs = append(addrs, t.addrs[k])
+	}
+	t.cc.NewAddress(addrs)
+}
+
+// decodeAddress returns false if the node is invalid or drained
+func decodeAddress(key string, value []byte) (resolver.Address, bool) {
+	node, err := registry.DecodeNode(path.Base(key), value)
+	if err != nil {
+		log.Printf("registry: invalid node %s: %s", key, err)
+		return resolver.Address{}, false
+	}
+	if node.Drained() {
+		return resolver.Address{}, false
+	}
+	return node.ResolverAddress(), true
+}
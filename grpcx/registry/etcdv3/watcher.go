@@ -0,0 +1,125 @@
+package etcdv3
+
+import (
+	"context"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/qeelyn/go-common/grpcx/registry"
+)
+
+// GetService returns the registered nodes of the service
+func (t *etcdv3Registry) GetService(serviceName string) ([]*registry.Node, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.options.Timeout)
+	defer cancel()
+	resp, err := t.client.Get(ctx, ServicePath(serviceName)+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*registry.Node, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		node, err := registry.DecodeNode(path.Base(string(kv.Key)), kv.Value)
+		if err != nil {
+			log.Printf("registry: invalid node %s: %s", kv.Key, err)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// ListServices returns the services names,the "/" in the names are replaced by "-" when registered.
+func (t *etcdv3Registry) ListServices() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.options.Timeout)
+	defer cancel()
+	resp, err := t.client.Get(ctx, SCHEMA+"/", clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var services []string
+	for _, kv := range resp.Kvs {
+		parts := strings.Split(strings.TrimPrefix(string(kv.Key), SCHEMA+"/"), "/")
+		if len(parts) != 2 || seen[parts[0]] {
+			continue
+		}
+		seen[parts[0]] = true
+		services = append(services, parts[0])
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// Watch watches the nodes of the service from now on
+func (t *etcdv3Registry) Watch(serviceName string) (registry.Watcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &etcdWatcher{
+		service: serviceName,
+		cancel:  cancel,
+		ch:      t.client.Watch(ctx, ServicePath(serviceName)+"/", clientv3.WithPrefix(), clientv3.WithPrevKV()),
+	}
+	return w, nil
+}
+
+type etcdWatcher struct {
+	service string
+	cancel  context.CancelFunc
+	ch      clientv3.WatchChan
+	// the events of the last response which are not returned
+	pending []*registry.Event
+}
+
+func (t *etcdWatcher) Next() (*registry.Event, error) {
+	for len(t.pending) == 0 {
+		resp, ok := <-t.ch
+		if !ok || resp.Canceled {
+			return nil, registry.ErrWatcherStopped
+		}
+		if err := resp.Err(); err != nil {
+			return nil, err
+		}
+		for _, ev := range resp.Events {
+			if e := t.event(ev); e != nil {
+				t.pending = append(t.pending, e)
+			}
+		}
+	}
+	e := t.pending[0]
+	t.pending = t.pending[1:]
+	return e, nil
+}
+
+func (t *etcdWatcher) event(ev *clientv3.Event) *registry.Event {
+	key := string(ev.Kv.Key)
+	id := path.Base(key)
+	e := &registry.Event{Service: t.service}
+	var err error
+	switch {
+	case ev.Type == clientv3.EventTypeDelete:
+		e.Type = registry.EventDelete
+		if ev.PrevKv != nil {
+			e.Node, err = registry.DecodeNode(id, ev.PrevKv.Value)
+		}
+		if e.Node == nil {
+			e.Node, err = &registry.Node{Id: id}, nil
+		}
+	case ev.IsCreate():
+		e.Type = registry.EventCreate
+		e.Node, err = registry.DecodeNode(id, ev.Kv.Value)
+	default:
+		e.Type = registry.EventUpdate
+		e.Node, err = registry.DecodeNode(id, ev.Kv.Value)
+	}
+	if err != nil {
+		log.Printf("registry: invalid node %s: %s", key, err)
+		return nil
+	}
+	return e
+}
+
+func (t *etcdWatcher) Stop() {
+	t.cancel()
+}
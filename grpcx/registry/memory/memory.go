@@ -0,0 +1,274 @@
+// Package memory provides an in-process registry with the grpc resolver,it is used by tests
+// or the services in one process instead of etcd.
+// Example:
+//	r := memory.NewRegistry()
+//	resolver.Register(r)
+//	r.Register("user", &registry.Node{Id: "n1", Address: "127.0.0.1:9000"})
+//	conn, err := dialer.Dial(r.Scheme()+":///user", dialer.WithDialOption(grpc.WithInsecure()))
+package memory
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the resolver scheme of the memory registry
+const Scheme = "memory"
+
+type Registry struct {
+	mu sync.RWMutex
+	// nodes by id of the services
+	services map[string]map[string]*registry.Node
+	watchers map[*watcher]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		services: make(map[string]map[string]*registry.Node),
+		watchers: make(map[*watcher]bool),
+	}
+}
+
+func copyNode(node *registry.Node) *registry.Node {
+	n := *node
+	if node.Metadata != nil {
+		n.Metadata = make(map[string]string, len(node.Metadata))
+		for k, v := range node.Metadata {
+			n.Metadata[k] = v
+		}
+	}
+	return &n
+}
+
+// put saves the node and returns the event,it is nil if the node is not changed. The lock must be held.
+func (t *Registry) put(serviceName string, node *registry.Node) *registry.Event {
+	nodes, ok := t.services[serviceName]
+	if !ok {
+		nodes = make(map[string]*registry.Node)
+		t.services[serviceName] = nodes
+	}
+	ev := &registry.Event{Type: registry.EventCreate, Service: serviceName, Node: copyNode(node)}
+	if old, ok := nodes[node.Id]; ok {
+		if reflect.DeepEqual(old, ev.Node) {
+			return nil
+		}
+		ev.Type = registry.EventUpdate
+	}
+	nodes[node.Id] = ev.Node
+	return ev
+}
+
+// remove deletes the node and returns the event,it is nil if the node doesn't exist. The lock must be held.
+func (t *Registry) remove(serviceName, id string) *registry.Event {
+	nodes := t.services[serviceName]
+	old, ok := nodes[id]
+	if !ok {
+		return nil
+	}
+	delete(nodes, id)
+	if len(nodes) == 0 {
+		delete(t.services, serviceName)
+	}
+	return &registry.Event{Type: registry.EventDelete, Service: serviceName, Node: old}
+}
+
+// publish sends the events to the watchers of the service. The lock must be held.
+func (t *Registry) publish(events ...*registry.Event) {
+	for _, ev := range events {
+		if ev == nil {
+			continue
+		}
+		for w := range t.watchers {
+			if w.service == ev.Service {
+				w.push(ev)
+			}
+		}
+	}
+}
+
+// Register adds or replaces the node,the options are ignored because the nodes never expire.
+func (t *Registry) Register(serviceName string, node *registry.Node, opts ...registry.RegisterOption) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.publish(t.put(serviceName, node))
+	return nil
+}
+
+func (t *Registry) Unregister(serviceName string, node *registry.Node) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.publish(t.remove(serviceName, node.Id))
+	return nil
+}
+
+// Set replaces all nodes of the service,the watchers receive the changes only.
+func (t *Registry) Set(serviceName string, nodes []*registry.Node) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keep := make(map[string]bool, len(nodes))
+	var events []*registry.Event
+	for _, node := range nodes {
+		keep[node.Id] = true
+		events = append(events, t.put(serviceName, node))
+	}
+	for id := range t.services[serviceName] {
+		if !keep[id] {
+			events = append(events, t.remove(serviceName, id))
+		}
+	}
+	t.publish(events...)
+}
+
+// GetService returns the copies of the nodes sorted by id
+func (t *Registry) GetService(serviceName string) ([]*registry.Node, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	nodes := make([]*registry.Node, 0, len(t.services[serviceName]))
+	for _, node := range t.services[serviceName] {
+		nodes = append(nodes, copyNode(node))
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Id < nodes[j].Id
+	})
+	return nodes, nil
+}
+
+func (t *Registry) ListServices() ([]string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	services := make([]string, 0, len(t.services))
+	for name := range t.services {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+func (t *Registry) Watch(serviceName string) (registry.Watcher, error) {
+	return t.watch(serviceName), nil
+}
+
+func (t *Registry) watch(serviceName string) *watcher {
+	w := &watcher{
+		service: serviceName,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	w.stop = func() {
+		t.mu.Lock()
+		delete(t.watchers, w)
+		t.mu.Unlock()
+	}
+	t.mu.Lock()
+	t.watchers[w] = true
+	t.mu.Unlock()
+	return w
+}
+
+// GetClient returns the registry itself
+func (t *Registry) GetClient() interface{} {
+	return t
+}
+
+func (t *Registry) Scheme() string {
+	return Scheme
+}
+
+// Build resolves the nodes of the service which is the endpoint of the target
+func (t *Registry) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
+	r := &memoryResolver{
+		registry: t,
+		service:  target.Endpoint,
+		cc:       cc,
+		w:        t.watch(target.Endpoint),
+	}
+	r.ResolveNow(resolver.ResolveNowOption{})
+	go r.run()
+	return r, nil
+}
+
+type memoryResolver struct {
+	registry *Registry
+	service  string
+	cc       resolver.ClientConn
+	w        *watcher
+}
+
+func (t *memoryResolver) run() {
+	for {
+		if _, err := t.w.Next(); err != nil {
+			return
+		}
+		t.ResolveNow(resolver.ResolveNowOption{})
+	}
+}
+
+func (t *memoryResolver) ResolveNow(resolver.ResolveNowOption) {
+	nodes, _ := t.registry.GetService(t.service)
+	addrs := make([]resolver.Address, 0, len(nodes))
+	for _, node := range nodes {
+		if !node.Drained() {
+			addrs = append(addrs, node.ResolverAddress())
+		}
+	}
+	t.cc.NewAddress(addrs)
+}
+
+func (t *memoryResolver) Close() {
+	t.w.Stop()
+}
+
+// watcher queues the events without blocking the registry
+type watcher struct {
+	service string
+	stop    func()
+
+	mu     sync.Mutex
+	queue  []*registry.Event
+	notify chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (t *watcher) push(ev *registry.Event) {
+	t.mu.Lock()
+	t.queue = append(t.queue, &registry.Event{Type: ev.Type, Service: ev.Service, Node: copyNode(ev.Node)})
+	t.mu.Unlock()
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (t *watcher) Next() (*registry.Event, error) {
+	for {
+		select {
+		case <-t.done:
+			return nil, registry.ErrWatcherStopped
+		default:
+		}
+		t.mu.Lock()
+		if len(t.queue) > 0 {
+			ev := t.queue[0]
+			t.queue = t.queue[1:]
+			t.mu.Unlock()
+			return ev, nil
+		}
+		t.mu.Unlock()
+		select {
+		case <-t.notify:
+		case <-t.done:
+		}
+	}
+}
+
+func (t *watcher) Stop() {
+	t.once.Do(func() {
+		t.stop()
+		close(t.done)
+	})
+}
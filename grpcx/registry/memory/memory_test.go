@@ -0,0 +1,121 @@
+package memory_test
+
+import (
+	"context"
+	"github.com/qeelyn/go-common/grpcx/dialer"
+	"github.com/qeelyn/go-common/grpcx/internal/mock"
+	"github.com/qeelyn/go-common/grpcx/internal/mock/prototest"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"github.com/qeelyn/go-common/grpcx/registry/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMemoryWatch(t *testing.T) {
+	r := memory.NewRegistry()
+	w, err := r.Watch("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &registry.Node{Id: "n1", Address: ":9000"}
+	r.Register("user", node)
+	r.Register("user", node)
+	r.Register("order", &registry.Node{Id: "n1", Address: ":9001"})
+	r.Register("user", &registry.Node{Id: "n1", Address: ":9000", Metadata: map[string]string{"zone": "a"}})
+	r.Unregister("user", node)
+	for _, typ := range []registry.EventType{registry.EventCreate, registry.EventUpdate, registry.EventDelete} {
+		ev, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Type != typ || ev.Service != "user" || ev.Node.Id != "n1" {
+			t.Errorf("expect %s, got %+v", typ, ev)
+		}
+	}
+	services, _ := r.ListServices()
+	if len(services) != 1 || services[0] != "order" {
+		t.Errorf("services: %v", services)
+	}
+	w.Stop()
+	if _, err := w.Next(); err != registry.ErrWatcherStopped {
+		t.Errorf("expect stopped, got %v", err)
+	}
+}
+
+func TestMemoryResolver(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	prototest.RegisterSayServer(srv, &mock.Hello{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	r := memory.NewRegistry()
+	resolver.Register(r)
+	r.Register(mock.TestSvrName, &registry.Node{Id: "n1", Address: lis.Addr().String()})
+
+	conn, err := dialer.Dial(r.Scheme()+":///"+mock.TestSvrName, dialer.WithDialOption(grpc.WithInsecure()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := prototest.NewSayClient(conn).Hello(ctx, &prototest.Request{Name: "memory"}, grpc.FailFast(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(res.Msg)
+}
+
+type clientConn struct {
+	addrs chan []resolver.Address
+}
+
+func (t *clientConn) NewAddress(addrs []resolver.Address) {
+	t.addrs <- addrs
+}
+
+func (t *clientConn) NewServiceConfig(string) {}
+
+func TestMemoryResolverDrained(t *testing.T) {
+	r := memory.NewRegistry()
+	cc := &clientConn{addrs: make(chan []resolver.Address, 10)}
+	rs, err := r.Build(resolver.Target{Endpoint: "user"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	next := func() []resolver.Address {
+		select {
+		case addrs := <-cc.addrs:
+			return addrs
+		case <-time.After(5 * time.Second):
+			t.Fatal("addresses are not resolved")
+		}
+		return nil
+	}
+	next()
+	r.Register("user", &registry.Node{Id: "n1", Address: "10.0.0.1:9000"})
+	if addrs := next(); len(addrs) != 1 {
+		t.Fatalf("addrs: %v", addrs)
+	}
+	drained := &registry.Node{Id: "n1", Address: "10.0.0.1:9000", Metadata: map[string]string{registry.MetadataDrained: "true"}}
+	r.Register("user", drained)
+	if addrs := next(); len(addrs) != 0 {
+		t.Errorf("the drained node is resolved: %v", addrs)
+	}
+	r.Register("user", &registry.Node{Id: "n2", Address: "10.0.0.2:9000"})
+	if addrs := next(); len(addrs) != 1 || addrs[0].Addr != "10.0.0.2:9000" {
+		t.Errorf("addrs: %v", addrs)
+	}
+	r.Register("user", &registry.Node{Id: "n1", Address: "10.0.0.1:9000"})
+	if addrs := next(); len(addrs) != 2 {
+		t.Errorf("the undrained node is not resolved: %v", addrs)
+	}
+}
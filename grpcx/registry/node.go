@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// the metadata keys which are commonly published by the nodes
+const (
+	MetadataVersion = "version"
+	MetadataZone    = "zone"
+	MetadataWeight  = "weight"
+	// MetadataCanary is "true" for the canary nodes
+	MetadataCanary = "canary"
+	// MetadataDrained is "true" for the nodes which are not serving,they are not resolved
+	MetadataDrained = "drained"
+)
+
+// EncodeNode returns the stored value of the node in the registries
+func EncodeNode(node *Node) ([]byte, error) {
+	return json.Marshal(node)
+}
+
+// DecodeNode parses the stored value of a node,the value of the older version which is the plain address
+// is also accepted. The id is used if the value has no id.
+func DecodeNode(id string, value []byte) (*Node, error) {
+	v := strings.TrimSpace(string(value))
+	if v == "" {
+		return nil, errors.New("registry: empty node value")
+	}
+	node := &Node{}
+	if strings.HasPrefix(v, "{") {
+		if err := json.Unmarshal(value, node); err != nil {
+			return nil, err
+		}
+	} else {
+		node.Address = v
+	}
+	if node.Id == "" {
+		node.Id = id
+	}
+	return node, nil
+}
+
+// Drained reports whether the node is marked as not serving
+func (t *Node) Drained() bool {
+	return t.Metadata[MetadataDrained] == "true"
+}
+
+// addressMetadata is the node metadata in the resolved address,it must be comparable
+// because the balancers use the addresses as map keys.
+type addressMetadata string
+
+// ResolverAddress converts the node to the address of the grpc resolver,the metadata of the node is kept
+// in the metadata of the address which is read by AddressMetadata.
+func (t *Node) ResolverAddress() resolver.Address {
+	addr := resolver.Address{Addr: t.Address}
+	if len(t.Metadata) > 0 {
+		md := make(url.Values, len(t.Metadata))
+		for k, v := range t.Metadata {
+			md.Set(k, v)
+		}
+		addr.Metadata = addressMetadata(md.Encode())
+	}
+	return addr
+}
+
+// AddressMetadata returns the node metadata of the resolved address,it is used by the balancers.
+func AddressMetadata(addr resolver.Address) map[string]string {
+	encoded, ok := addr.Metadata.(addressMetadata)
+	if !ok {
+		return nil
+	}
+	values, _ := url.ParseQuery(string(encoded))
+	md := make(map[string]string, len(values))
+	for k := range values {
+		md[k] = values.Get(k)
+	}
+	return md
+}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"crypto/tls"
+	"errors"
 	"time"
 )
 
@@ -9,9 +10,62 @@ import (
 type Registry interface {
 	Register(serviceName string, node *Node, opts ...RegisterOption) error
 	Unregister(serviceName string, node *Node) error
+	// GetService returns the registered nodes of the service,it is empty if no node is registered
+	GetService(serviceName string) ([]*Node, error)
+	// ListServices returns the names of the services which have registered nodes
+	ListServices() ([]string, error)
+	// Watch watches the node changes of the service
+	Watch(serviceName string) (Watcher, error)
 	GetClient() interface{}
 }
 
+// ErrWatcherStopped is returned by Watcher.Next after the watcher is stopped
+var ErrWatcherStopped = errors.New("registry: watcher stopped")
+
+type EventType int
+
+const (
+	EventCreate EventType = iota
+	EventUpdate
+	EventDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventCreate:
+		return "create"
+	case EventUpdate:
+		return "update"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event is a node change of a service,the node of the delete event may only have the id.
+type Event struct {
+	Type    EventType
+	Service string
+	Node    *Node
+}
+
+// Watcher is returned by Registry.Watch
+// Example:
+//	w, err := r.Watch("user")
+//	defer w.Stop()
+//	for {
+//		ev, err := w.Next()
+//		if err != nil {
+//			break
+//		}
+//		log.Println(ev.Type, ev.Node.Address)
+//	}
+type Watcher interface {
+	// Next blocks until the next event,ErrWatcherStopped is returned after Stop
+	Next() (*Event, error)
+	Stop()
+}
+
 type Node struct {
 	Id       string            `json:"id"`
 	Address  string            `json:"address"`
@@ -47,6 +101,9 @@ func Dsn(dsn string) Option {
 	}
 }
 
+// RegisterTTL sets the TTL of the registration,the node is removed by the registry if it is not kept alive in TTL.
+// A TTL less than a second means the default TTL of the registry,such as 10s of etcdv3 and consul,
+// the nodes are never registered without TTL.
 func RegisterTTL(t time.Duration) RegisterOption {
 	return func(o *RegisterOptions) {
 		o.TTL = t
@@ -1 +1,94 @@
 package registry_test
+
+import (
+	"context"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNodeCodec(t *testing.T) {
+	node := &registry.Node{Id: "srv-1", Address: "10.0.0.1:9000", Metadata: map[string]string{
+		registry.MetadataVersion: "v1.0.0",
+		registry.MetadataZone:    "hz-a",
+	}}
+	value, err := registry.EncodeNode(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := registry.DecodeNode("other", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, node) {
+		t.Errorf("decoded node: %+v", got)
+	}
+	addr := got.ResolverAddress()
+	if addr.Addr != node.Address || registry.AddressMetadata(addr)[registry.MetadataZone] != "hz-a" {
+		t.Errorf("resolver address: %+v", addr)
+	}
+}
+
+func TestDecodePlainAddress(t *testing.T) {
+	node, err := registry.DecodeNode("srv-1", []byte("10.0.0.1:9000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Id != "srv-1" || node.Address != "10.0.0.1:9000" || node.Metadata != nil {
+		t.Errorf("node: %+v", node)
+	}
+	if _, err := registry.DecodeNode("srv-1", nil); err == nil {
+		t.Error("empty value must be invalid")
+	}
+	if md := registry.AddressMetadata(node.ResolverAddress()); md != nil {
+		t.Errorf("metadata: %v", md)
+	}
+}
+
+func TestResolverAddressComparable(t *testing.T) {
+	node := &registry.Node{Id: "srv-1", Address: "10.0.0.1:9000", Metadata: map[string]string{"a": "1", "b": "2"}}
+	// the balancers use the addresses as map keys
+	m := map[interface{}]bool{node.ResolverAddress(): true}
+	if !m[node.ResolverAddress()] {
+		t.Error("the same node must have the equal address")
+	}
+}
+
+func TestResolveMetadataWithRoundRobin(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	r, cleanup := manual.GenerateAndRegisterManualResolver()
+	defer cleanup()
+	node := &registry.Node{Id: "srv-1", Address: lis.Addr().String(), Metadata: map[string]string{
+		registry.MetadataVersion: "v1.0.0",
+		registry.MetadataZone:    "hz-a",
+	}}
+	r.InitialAddrs([]resolver.Address{node.ResolverAddress()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, r.Scheme()+":///srv", grpc.WithInsecure(), grpc.WithBalancerName(roundrobin.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.FailFast(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package static provides the registry with a fixed node list from the configuration or a file,
+// the file or the configuration is watched and the changes are sent to the resolvers. The nodes are listed by service:
+//	user:
+//	  - id: user-1
+//	    address: 10.0.0.1:9000
+//	    metadata:
+//	      zone: hz-a
+//	  - id: user-2
+//	    address: 10.0.0.2:9000
+// The file may also be JSON with the same structure.
+// Example:
+//	r, err := static.NewRegistry(registry.Dsn("/etc/app/services.yaml"))
+//	resolver.Register(r)
+//	conn, err := dialer.Dial(r.Scheme()+":///user", dialer.WithDialOption(grpc.WithInsecure()))
+package static
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"github.com/qeelyn/go-common/grpcx/registry/memory"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// Scheme is the resolver scheme of the static registry
+const Scheme = "static"
+
+// Registry serves the nodes of the configuration,Register and Unregister are ignored
+// because the nodes are maintained in the configuration.
+type Registry struct {
+	*memory.Registry
+	file    string
+	watcher *fsnotify.Watcher
+	// the configuration changes are ignored after Close
+	closed int32
+}
+
+// NewRegistry reads the nodes from the file of Dsn and reloads them when the file changes
+func NewRegistry(opts ...registry.Option) (*Registry, error) {
+	var options registry.Options
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Dsn == "" {
+		return nil, errors.New("registry: static file is not set")
+	}
+	t := &Registry{Registry: memory.NewRegistry(), file: filepath.Clean(options.Dsn)}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	if err := t.watch(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// NewFromConfig reads the nodes from the key of cnf,if cnf is returned by config.LoadConfig it is watched
+// and the changes of the key are sent to the resolvers,otherwise the nodes are read once.
+// Example:
+//	r, err := static.NewFromConfig(cnf, "registry.services")
+func NewFromConfig(cnf *viper.Viper, key string) (*Registry, error) {
+	t := &Registry{Registry: memory.NewRegistry()}
+	if err := t.loadConfig(config.Current(cnf), key); err != nil {
+		return nil, err
+	}
+	if config.Layers(cnf) == nil {
+		return t, nil
+	}
+	w, err := config.Watch(cnf, nil)
+	if err != nil {
+		return nil, err
+	}
+	w.OnKeyChange(key, func(old, new interface{}) {
+		if atomic.LoadInt32(&t.closed) == 1 {
+			return
+		}
+		if err := t.loadConfig(w.Viper(), key); err != nil {
+			log.Printf("registry: keep the last nodes: %s", err)
+		}
+	})
+	return t, nil
+}
+
+// loadConfig replaces the services by the key of cnf
+func (t *Registry) loadConfig(cnf *viper.Viper, key string) error {
+	var services map[string][]*registry.Node
+	if err := cnf.UnmarshalKey(key, &services); err != nil {
+		return fmt.Errorf("registry: invalid services of %s: %s", key, err)
+	}
+	return t.load(services)
+}
+
+// Reload reads the file again
+func (t *Registry) Reload() error {
+	if t.file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(t.file)
+	if err != nil {
+		return err
+	}
+	// the file may be truncated by the writer
+	if len(bytes.TrimSpace(data)) == 0 {
+		return fmt.Errorf("registry: file %s is empty", t.file)
+	}
+	var services map[string][]*registry.Node
+	if strings.ToLower(filepath.Ext(t.file)) == ".json" {
+		err = json.Unmarshal(data, &services)
+	} else {
+		err = yaml.Unmarshal(data, &services)
+	}
+	if err != nil {
+		return fmt.Errorf("registry: invalid file %s: %s", t.file, err)
+	}
+	return t.load(services)
+}
+
+// load replaces all services,the services which are not listed are removed
+func (t *Registry) load(services map[string][]*registry.Node) error {
+	for name, nodes := range services {
+		for i, node := range nodes {
+			if node == nil || node.Address == "" {
+				return fmt.Errorf("registry: node %d of %s has no address", i, name)
+			}
+			if node.Id == "" {
+				node.Id = node.Address
+			}
+		}
+	}
+	names, _ := t.ListServices()
+	for _, name := range names {
+		if _, ok := services[name]; !ok {
+			t.Set(name, nil)
+		}
+	}
+	for name, nodes := range services {
+		t.Set(name, nodes)
+	}
+	return nil
+}
+
+// watch watches the directory of the file because editors may replace the file
+func (t *Registry) watch() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err = w.Add(filepath.Dir(t.file)); err != nil {
+		w.Close()
+		return err
+	}
+	t.watcher = w
+	go func() {
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) != t.file || ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := t.Reload(); err != nil {
+					log.Printf("registry: keep the last nodes: %s", err)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("registry: watch %s: %s", t.file, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close stops watching the file or the configuration
+func (t *Registry) Close() error {
+	atomic.StoreInt32(&t.closed, 1)
+	if t.watcher == nil {
+		return nil
+	}
+	return t.watcher.Close()
+}
+
+func (t *Registry) Register(serviceName string, node *registry.Node, opts ...registry.RegisterOption) error {
+	return nil
+}
+
+func (t *Registry) Unregister(serviceName string, node *registry.Node) error {
+	return nil
+}
+
+func (t *Registry) Scheme() string {
+	return Scheme
+}
+
+// GetClient returns the registry itself
+func (t *Registry) GetClient() interface{} {
+	return t
+}
@@ -0,0 +1,124 @@
+package static_test
+
+import (
+	"github.com/qeelyn/go-common/config"
+	"github.com/qeelyn/go-common/config/options"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"github.com/qeelyn/go-common/grpcx/registry/static"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "services.yaml")
+	content := "user:\n  - id: u1\n    address: 10.0.0.1:9000\n    metadata:\n      zone: a\n  - address: 10.0.0.2:9000\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := static.NewRegistry(registry.Dsn(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	nodes, err := r.GetService("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].Id != "10.0.0.2:9000" || nodes[1].Metadata["zone"] != "a" {
+		t.Fatalf("nodes: %v", nodes)
+	}
+
+	w, _ := r.Watch("user")
+	defer w.Stop()
+	if err := ioutil.WriteFile(file, []byte("user:\n  - id: u1\n    address: 10.0.0.1:9000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan []registry.EventType)
+	go func() {
+		var types []registry.EventType
+		for len(types) < 2 {
+			ev, err := w.Next()
+			if err != nil {
+				return
+			}
+			types = append(types, ev.Type)
+		}
+		done <- types
+	}()
+	select {
+	case types := <-done:
+		// u1 metadata is removed and the second node is deleted
+		if types[0] == types[1] {
+			t.Errorf("events: %v", types)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("file change is not watched")
+	}
+}
+
+func TestStaticConfig(t *testing.T) {
+	cnf := viper.New()
+	cnf.SetConfigType("yaml")
+	err := cnf.ReadConfig(strings.NewReader("registry:\n  services:\n    user:\n      - id: u1\n        address: 10.0.0.1:9000\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := static.NewFromConfig(cnf, "registry.services")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, _ := r.GetService("user")
+	if len(nodes) != 1 || nodes[0].Address != "10.0.0.1:9000" {
+		t.Errorf("nodes: %v", nodes)
+	}
+	if _, err := static.NewFromConfig(cnf, "registry"); err == nil {
+		t.Error("expect invalid services")
+	}
+}
+
+func TestStaticWatchedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(file, []byte("services:\n  user:\n    - address: 10.0.0.1:9000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cnf, err := config.LoadConfig(&options.Options{Path: dir, FileName: "config.yaml", WatchDebounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer config.Release(cnf)
+	r, err := static.NewFromConfig(cnf, "services")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := ioutil.WriteFile(file, []byte("services:\n  user:\n    - address: 10.0.0.2:9000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		nodes, _ := r.GetService("user")
+		if len(nodes) == 1 && nodes[0].Address == "10.0.0.2:9000" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the nodes are not reloaded: %v", nodes)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
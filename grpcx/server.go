@@ -1,6 +1,7 @@
 package grpcx
 
 import (
+	"context"
 	"github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/grpc-ecosystem/go-grpc-middleware/auth"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
@@ -115,7 +116,16 @@ func (t Server) BuildGrpcServer() *grpc.Server {
 	return rpcSrv
 }
 
-func (t Server) Run(rpcSrv *grpc.Server, listen string) error {
+// Run serves rpcSrv at listen until ctx is done or SIGTERM/SIGINT is received,then shuts down gracefully.
+// The node is registered after the server is serving and the health checks pass,
+// and deregistered before the server stops.
+// Example:
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//	if err := srv.Run(ctx, rpcSrv, ":9000"); err != nil {
+//		log.Fatal(err)
+//	}
+func (t Server) Run(ctx context.Context, rpcSrv *grpc.Server, listen string) error {
 	lis, err := net.Listen("tcp", listen)
 	if err != nil {
 		panic(err)
@@ -125,16 +135,32 @@ func (t Server) Run(rpcSrv *grpc.Server, listen string) error {
 		t.StartPrometheus(rpcSrv)
 	}
 
-	if t.Option.register != nil {
-		node := &registry.Node{Id: t.Name, Address: t.Option.RegistryListen}
-		if err = t.Option.register.Register(t.Option.registryServiceName, node); err != nil {
-			return err
-		}
-		defer t.Option.register.Unregister(t.Option.registryServiceName, node)
-	}
+	node := &registry.Node{Id: t.Name, Address: t.Option.RegistryListen, Metadata: t.Option.registryMetadata}
+	keeper := newHealthKeeper(t.Name, t.Option, node, rpcSrv)
 
 	log.Printf("%s tcp server will be ready for listening at:%s", t.Name, listen)
-	return rpcSrv.Serve(lis)
+	served := make(chan error, 1)
+	go func() {
+		served <- rpcSrv.Serve(lis)
+	}()
+	if err = keeper.update(context.Background()); err != nil {
+		rpcSrv.Stop()
+		<-served
+		return err
+	}
+	l := &t.Option.lifecycle
+	l.mu.Lock()
+	l.rpcSrv, l.shutdownDone, l.shutdownErr = rpcSrv, nil, nil
+	l.keeperStop, l.keeperStopped, l.keeperDone = make(chan struct{}), false, make(chan struct{})
+	keeperStop, keeperDone := l.keeperStop, l.keeperDone
+	l.mu.Unlock()
+	go func() {
+		keeper.run(keeperStop)
+		close(keeperDone)
+	}()
+	err = t.waitShutdown(ctx, served)
+	l.reset()
+	return err
 }
 
 func (t Server) StartPrometheus(rpcSrv *grpc.Server) {
@@ -147,9 +173,10 @@ func (t Server) StartPrometheus(rpcSrv *grpc.Server) {
 			Handler: promhttp.Handler(),
 			Addr:    t.Option.prometheusListen,
 		}
+		t.Option.lifecycle.setMetrics(httpServer)
 		go func() {
 			log.Printf("starting prometheus http server at:%s", httpServer.Addr)
-			if err := httpServer.ListenAndServe(); err != nil {
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				log.Fatal("Unable to start a http server.")
 			}
 		}()
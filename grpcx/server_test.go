@@ -47,13 +47,13 @@ func TestMutilServer(t *testing.T) {
 	//arpc.RegisterService(nil,nil)
 	a.StartPrometheus(nil)
 	go func() {
-		a.Run(arpc, "9009")
+		a.Run(context.Background(), arpc, "9009")
 	}()
 
 	brpc := a.BuildGrpcServer()
 	prototest.RegisterSayServer(brpc, &mock.Hello{})
 	b.StartPrometheus(nil)
-	b.Run(brpc, "9010")
+	b.Run(context.Background(), brpc, "9010")
 }
 
 func TestWithTracerLog(t *testing.T) {
@@ -85,7 +85,7 @@ func TestWithTracerLog(t *testing.T) {
 
 	arpc := a.BuildGrpcServer()
 	prototest.RegisterSayServer(arpc, &mock.Hello{})
-	go a.Run(arpc, mock.TestSvrListen)
+	go a.Run(context.Background(), arpc, mock.TestSvrListen)
 
 	cc, err := dialer.Dial(mock.TestSvrListen,
 		dialer.WithTracer(opentracing.GlobalTracer()),
@@ -164,7 +164,7 @@ func TestWithTracerId(t *testing.T) {
 
 	arpc := a.BuildGrpcServer()
 	prototest.RegisterSayServer(arpc, &mock.Hello{})
-	go a.Run(arpc, mock.TestSvrListen)
+	go a.Run(context.Background(), arpc, mock.TestSvrListen)
 
 	cc, err := dialer.Dial(mock.TestSvrListen,
 		dialer.WithDialOption(grpc.WithInsecure()),
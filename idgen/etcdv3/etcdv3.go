@@ -0,0 +1,154 @@
+// Package etcdv3 leases the worker ids of idgen by the etcd client of the etcdv3 registry,
+// a worker id is a key with the session lease,the last time of the ids is saved while the worker id is held
+// and kept after the release.
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	"github.com/qeelyn/go-common/idgen"
+)
+
+const (
+	// DefaultTTL is the session TTL without WithTTL
+	DefaultTTL = 10 * time.Second
+
+	keyPrefix = "qeelyn-idgen"
+)
+
+type etcdAllocator struct {
+	r      registry.Registry
+	prefix string
+	ttl    time.Duration
+}
+
+type Option func(*etcdAllocator)
+
+// WithTTL sets the session TTL,the worker id is lost after the replica is disconnected for the TTL.
+func WithTTL(ttl time.Duration) Option {
+	return func(a *etcdAllocator) {
+		a.ttl = ttl
+	}
+}
+
+// NewAllocator returns the allocator of the worker ids of name,the generators of the same name never share a worker id.
+func NewAllocator(r registry.Registry, name string, opts ...Option) idgen.Allocator {
+	t := &etcdAllocator{r: r, prefix: path.Join(keyPrefix, name), ttl: DefaultTTL}
+	for _, o := range opts {
+		o(t)
+	}
+	if t.ttl < time.Second {
+		t.ttl = time.Second
+	}
+	return t
+}
+
+func (t *etcdAllocator) workerKey(id int64) string {
+	return path.Join(t.prefix, "worker", strconv.FormatInt(id, 10))
+}
+
+func (t *etcdAllocator) lastKey(id int64) string {
+	return path.Join(t.prefix, "last", strconv.FormatInt(id, 10))
+}
+
+// Acquire puts the first free worker id from a random start with the session lease
+func (t *etcdAllocator) Acquire(ctx context.Context) (idgen.Lease, error) {
+	client, ok := t.r.GetClient().(*clientv3.Client)
+	if !ok {
+		return nil, errors.New("idgen: the registry has no etcd client")
+	}
+	s, err := concurrency.NewSession(client, concurrency.WithTTL(int(t.ttl/time.Second)))
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	owner := host + ":" + strconv.Itoa(os.Getpid())
+	start := rand.Int63n(idgen.MaxWorkerID + 1)
+	for i := int64(0); i <= idgen.MaxWorkerID; i++ {
+		id := (start + i) % (idgen.MaxWorkerID + 1)
+		key := t.workerKey(id)
+		resp, err := client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, owner, clientv3.WithLease(s.Lease())), clientv3.OpGet(t.lastKey(id))).
+			Commit()
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if !resp.Succeeded {
+			continue
+		}
+		l := &etcdLease{allocator: t, session: s, id: id, createRevision: resp.Header.Revision}
+		if kvs := resp.Responses[1].GetResponseRange().Kvs; len(kvs) > 0 {
+			if ms, err := strconv.ParseInt(string(kvs[0].Value), 10, 64); err == nil {
+				l.lastTime = time.Unix(0, ms*int64(time.Millisecond))
+			}
+		}
+		return l, nil
+	}
+	s.Close()
+	return nil, idgen.ErrNoWorkerID
+}
+
+type etcdLease struct {
+	allocator *etcdAllocator
+	session   *concurrency.Session
+	id        int64
+	lastTime  time.Time
+	// the revision of the worker key,the last time is saved only if the key is not recreated by another holder
+	createRevision int64
+}
+
+func (t *etcdLease) ID() int64 {
+	return t.id
+}
+
+func (t *etcdLease) Done() <-chan struct{} {
+	return t.session.Done()
+}
+
+func (t *etcdLease) LastTime() time.Time {
+	return t.lastTime
+}
+
+// Checkpoint saves the mark as the last time while the worker key is held
+func (t *etcdLease) Checkpoint(ctx context.Context, mark time.Time) error {
+	return t.save(ctx, mark)
+}
+
+// save puts the last time if the worker key is held by the lease
+func (t *etcdLease) save(ctx context.Context, last time.Time) error {
+	ms := last.UnixNano() / int64(time.Millisecond)
+	key := t.allocator.workerKey(t.id)
+	resp, err := t.session.Client().Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", t.createRevision)).
+		Then(clientv3.OpPut(t.allocator.lastKey(t.id), strconv.FormatInt(ms, 10))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return idgen.ErrWorkerLost
+	}
+	return nil
+}
+
+// Release saves the last time and revokes the session,the worker key is deleted with the lease.
+func (t *etcdLease) Release(ctx context.Context, last time.Time) error {
+	if !last.IsZero() {
+		if err := t.save(ctx, last); err != nil {
+			t.session.Close()
+			return err
+		}
+	}
+	return t.session.Close()
+}
@@ -0,0 +1,37 @@
+package etcdv3_test
+
+import (
+	"context"
+	"github.com/qeelyn/go-common/grpcx/registry"
+	retcd "github.com/qeelyn/go-common/grpcx/registry/etcdv3"
+	"github.com/qeelyn/go-common/idgen"
+	"github.com/qeelyn/go-common/idgen/etcdv3"
+	"testing"
+	"time"
+)
+
+func TestAllocator(t *testing.T) {
+	r, err := retcd.NewRegistry(registry.Dsn("127.0.0.1:2379"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	allocator := etcdv3.NewAllocator(r, "idgen-test")
+	g1, err := idgen.New(ctx, allocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g1.Close(ctx)
+	g2, err := idgen.New(ctx, allocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g2.Close(ctx)
+	if g1.WorkerID() == g2.WorkerID() {
+		t.Error("the worker ids must be different")
+	}
+	if _, err := g1.Next(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,280 @@
+// Package idgen generates the sortable 64-bit ids across replicas in the snowflake layout:
+//	1 bit unused | 41 bits milliseconds since the epoch | 10 bits worker id | 12 bits sequence
+// The worker id is leased from an Allocator so that the replicas never share one,
+// idgen/etcdv3 leases by the etcd client of the registry and MemoryAllocator leases in process for tests.
+// The next holder of a worker id generates the ids after the last time of the previous holder:
+// the time of the last id is saved by Close,and if the lease is a Checkpointer the generator saves a mark
+// ahead of its clock periodically and never generates the ids after the mark,
+// so that the ids are not reissued even if the previous holder crashed or lost the lease.
+// Example:
+//	g, err := idgen.New(ctx, etcdv3.NewAllocator(r, "order"))
+//	id, err := g.Next()
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	WorkerBits   = 10
+	SequenceBits = 12
+	// MaxWorkerID is the max worker id
+	MaxWorkerID = 1<<WorkerBits - 1
+
+	maxSequence = 1<<SequenceBits - 1
+	timeShift   = WorkerBits + SequenceBits
+	// DefaultMaxClockBackward is the clock backward which is waited out without error
+	DefaultMaxClockBackward = 10 * time.Millisecond
+	// DefaultReserve is how far the checkpoint mark is ahead of the clock
+	DefaultReserve = 2 * time.Second
+)
+
+// DefaultEpoch is the start time of the ids,2018-01-01 UTC
+var DefaultEpoch = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	// ErrWorkerLost is returned by Next after the lease of the worker id is lost,a new generator is needed.
+	ErrWorkerLost = errors.New("idgen: worker id lease is lost")
+	// ErrNoWorkerID is returned by the allocators when all worker ids are in use
+	ErrNoWorkerID = errors.New("idgen: no free worker id")
+	// ErrNotReserved is returned by Next when the clock passes the checkpoint mark,the checkpoints are failing.
+	ErrNotReserved = errors.New("idgen: the time of the ids is not reserved")
+)
+
+// ClockBackwardError is returned by Next when the clock moves backwards more than the max clock backward
+type ClockBackwardError struct {
+	Backward time.Duration
+}
+
+func (t *ClockBackwardError) Error() string {
+	return fmt.Sprintf("idgen: clock moved backwards by %s", t.Backward)
+}
+
+// Allocator leases the worker ids
+type Allocator interface {
+	Acquire(ctx context.Context) (Lease, error)
+}
+
+// Lease holds a worker id until it is released or lost
+type Lease interface {
+	ID() int64
+	// Done is closed when the lease is released or lost
+	Done() <-chan struct{}
+	// LastTime is the last time reported by the previous holder of the id,the ids are generated after it.
+	LastTime() time.Time
+	// Release reports the last time of the ids and frees the worker id
+	Release(ctx context.Context, last time.Time) error
+}
+
+// Checkpointer is implemented by the leases which save the last time while the worker id is held,
+// it returns ErrWorkerLost if the lease is lost.
+type Checkpointer interface {
+	Checkpoint(ctx context.Context, mark time.Time) error
+}
+
+type Option func(*Generator)
+
+// WithEpoch sets the start time of the ids,it must be the same for all replicas.
+func WithEpoch(epoch time.Time) Option {
+	return func(g *Generator) {
+		g.epoch = epoch
+	}
+}
+
+// WithMaxClockBackward sets the clock backward which is waited out,Next fails if the clock moves back further.
+func WithMaxClockBackward(d time.Duration) Option {
+	return func(g *Generator) {
+		g.maxBackward = d
+	}
+}
+
+// WithReserve sets how far the checkpoint mark is ahead of the clock,the mark is saved every half of it.
+// It should be less than the lease TTL,so that the mark is passed before the worker id of a crashed
+// generator is leased again.
+func WithReserve(d time.Duration) Option {
+	return func(g *Generator) {
+		g.reserve = d
+	}
+}
+
+// WithClock sets the clock of the generator,it is used by tests.
+func WithClock(now func() time.Time) Option {
+	return func(g *Generator) {
+		g.now = now
+	}
+}
+
+// Generator generates the ids of a worker id,it is safe for concurrent use.
+type Generator struct {
+	lease       Lease
+	epoch       time.Time
+	maxBackward time.Duration
+	reserve     time.Duration
+	now         func() time.Time
+	// the lease which saves the mark,nil if the ids are not limited by the mark
+	checkpointer Checkpointer
+	stop         chan struct{}
+	done         chan struct{}
+	closeOnce    sync.Once
+
+	mu       sync.Mutex
+	lastTick int64
+	sequence int64
+	// the ids are generated before the tick of the saved mark
+	reserved int64
+}
+
+// New leases a worker id from allocator and returns its generator
+func New(ctx context.Context, allocator Allocator, opts ...Option) (*Generator, error) {
+	lease, err := allocator.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if lease.ID() < 0 || lease.ID() > MaxWorkerID {
+		lease.Release(ctx, time.Time{})
+		return nil, fmt.Errorf("idgen: invalid worker id %d", lease.ID())
+	}
+	g := &Generator{
+		lease:       lease,
+		epoch:       DefaultEpoch,
+		maxBackward: DefaultMaxClockBackward,
+		reserve:     DefaultReserve,
+		now:         time.Now,
+	}
+	for _, o := range opts {
+		o(g)
+	}
+	// the ids of the previous holder may be ahead of the local clock,
+	// and the sequences of its last millisecond may be used up
+	if last := lease.LastTime(); !last.IsZero() {
+		g.lastTick = g.tick(last) + 1
+	}
+	if cp, ok := lease.(Checkpointer); ok && g.reserve > 0 {
+		g.checkpointer = cp
+		if err := g.checkpoint(ctx); err != nil {
+			lease.Release(ctx, time.Time{})
+			return nil, err
+		}
+		g.stop, g.done = make(chan struct{}), make(chan struct{})
+		go g.keepReserved()
+	}
+	return g, nil
+}
+
+// checkpoint saves the mark ahead of the clock and the last id
+func (t *Generator) checkpoint(ctx context.Context) error {
+	t.mu.Lock()
+	from := t.tick(t.now())
+	if from < t.lastTick {
+		from = t.lastTick
+	}
+	t.mu.Unlock()
+	mark := t.epoch.Add(time.Duration(from)*time.Millisecond + t.reserve)
+	if err := t.checkpointer.Checkpoint(ctx, mark); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	if tick := t.tick(mark); tick > t.reserved {
+		t.reserved = tick
+	}
+	t.mu.Unlock()
+	return nil
+}
+
+// keepReserved saves the mark every half of the reserve until closed or the lease is lost
+func (t *Generator) keepReserved() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.reserve / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-t.lease.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), t.reserve/2)
+			if err := t.checkpoint(ctx); err != nil {
+				log.Printf("idgen: failed to save the mark of worker %d: %s", t.lease.ID(), err)
+			}
+			cancel()
+		}
+	}
+}
+
+// WorkerID returns the leased worker id
+func (t *Generator) WorkerID() int64 {
+	return t.lease.ID()
+}
+
+func (t *Generator) tick(at time.Time) int64 {
+	return int64(at.Sub(t.epoch) / time.Millisecond)
+}
+
+// Next returns a new id,it waits if the clock moves backwards within the max clock backward
+// or the sequence of the millisecond is used up. ErrNotReserved is returned if the clock passes the saved mark.
+func (t *Generator) Next() (int64, error) {
+	select {
+	case <-t.lease.Done():
+		return 0, ErrWorkerLost
+	default:
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.tick(t.now())
+	if now < t.lastTick {
+		backward := time.Duration(t.lastTick-now) * time.Millisecond
+		if backward > t.maxBackward {
+			return 0, &ClockBackwardError{Backward: backward}
+		}
+		now = t.waitUntil(t.lastTick)
+	}
+	if now == t.lastTick {
+		t.sequence = (t.sequence + 1) & maxSequence
+		if t.sequence == 0 {
+			now = t.waitUntil(t.lastTick + 1)
+		}
+	} else {
+		t.sequence = 0
+	}
+	if t.checkpointer != nil && now >= t.reserved {
+		return 0, ErrNotReserved
+	}
+	t.lastTick = now
+	return now<<timeShift | t.lease.ID()<<SequenceBits | t.sequence, nil
+}
+
+// waitUntil sleeps until the tick is reached
+func (t *Generator) waitUntil(tick int64) int64 {
+	now := t.tick(t.now())
+	for now < tick {
+		time.Sleep(time.Duration(tick-now) * time.Millisecond)
+		now = t.tick(t.now())
+	}
+	return now
+}
+
+// Close stops saving the mark and releases the worker id with the time of the last id
+func (t *Generator) Close(ctx context.Context) error {
+	t.closeOnce.Do(func() {
+		if t.stop != nil {
+			close(t.stop)
+			<-t.done
+		}
+	})
+	t.mu.Lock()
+	last := t.epoch.Add(time.Duration(t.lastTick) * time.Millisecond)
+	t.mu.Unlock()
+	return t.lease.Release(ctx, last)
+}
+
+// Parse returns the time,worker id and sequence of the id which is generated with epoch
+func Parse(id int64, epoch time.Time) (at time.Time, workerID int64, sequence int64) {
+	at = epoch.Add(time.Duration(id>>timeShift) * time.Millisecond)
+	return at, id >> SequenceBits & MaxWorkerID, id & maxSequence
+}
@@ -0,0 +1,241 @@
+package idgen_test
+
+import (
+	"context"
+	"errors"
+	"github.com/qeelyn/go-common/idgen"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenerator(t *testing.T) {
+	ctx := context.Background()
+	allocator := idgen.NewMemoryAllocator()
+	g1, err := idgen.New(ctx, allocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, err := idgen.New(ctx, allocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g1.WorkerID() == g2.WorkerID() {
+		t.Fatal("the worker ids must be different")
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int64]bool)
+	var wg sync.WaitGroup
+	for _, g := range []*idgen.Generator{g1, g2, g1, g2} {
+		wg.Add(1)
+		go func(g *idgen.Generator) {
+			defer wg.Done()
+			var last int64
+			for i := 0; i < 5000; i++ {
+				id, err := g.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if g == g1 && id <= last {
+					// ids of a generator are increasing in a goroutine
+					t.Errorf("id %d is not after %d", id, last)
+				}
+				last = id
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("duplicated id %d", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	id, _ := g2.Next()
+	at, worker, _ := idgen.Parse(id, idgen.DefaultEpoch)
+	if worker != g2.WorkerID() || time.Since(at) > time.Second {
+		t.Errorf("parsed %s, %d", at, worker)
+	}
+
+	allocator.Revoke(g1.WorkerID())
+	if _, err := g1.Next(); err != idgen.ErrWorkerLost {
+		t.Errorf("expect worker lost, got %v", err)
+	}
+}
+
+// clock is the local clock with an offset
+type clock struct {
+	offset int64
+}
+
+func (t *clock) now() time.Time {
+	return time.Now().Add(time.Duration(atomic.LoadInt64(&t.offset)))
+}
+
+func (t *clock) set(offset time.Duration) {
+	atomic.StoreInt64(&t.offset, int64(offset))
+}
+
+func TestClockBackward(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{}
+	g, err := idgen.New(ctx, idgen.NewMemoryAllocator(), idgen.WithClock(c.now),
+		idgen.WithMaxClockBackward(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, _ := g.Next()
+	// waits out the small backward
+	c.set(-10 * time.Millisecond)
+	id, err := g.Next()
+	if err != nil || id <= last {
+		t.Fatalf("id %d after %d: %v", id, last, err)
+	}
+	c.set(-time.Second)
+	if _, err := g.Next(); err == nil {
+		t.Fatal("expect clock backward error")
+	} else if _, ok := err.(*idgen.ClockBackwardError); !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestReleasedLastTime(t *testing.T) {
+	ctx := context.Background()
+	allocator := idgen.NewMemoryAllocator()
+	g, err := idgen.New(ctx, allocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Next(); err != nil {
+		t.Fatal(err)
+	}
+	g.Close(ctx)
+
+	// the next holder of the worker id has a clock one second behind
+	c := &clock{}
+	c.set(-time.Second)
+	g, err = idgen.New(ctx, allocator, idgen.WithClock(c.now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Next(); err == nil {
+		t.Error("the ids must not be generated before the last time of the previous holder")
+	}
+}
+
+func TestHandoffInSameMillisecond(t *testing.T) {
+	ctx := context.Background()
+	allocator := idgen.NewMemoryAllocator()
+	g, err := idgen.New(ctx, allocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last int64
+	for i := 0; i < 100; i++ {
+		if last, err = g.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.Close(ctx)
+
+	g, err = idgen.New(ctx, allocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close(ctx)
+	if id, err := g.Next(); err != nil || id <= last {
+		t.Errorf("id %d of the next holder is not after %d: %v", id, last, err)
+	}
+}
+
+func TestCrashedHolder(t *testing.T) {
+	ctx := context.Background()
+	allocator := idgen.NewMemoryAllocator()
+	g, err := idgen.New(ctx, allocator, idgen.WithReserve(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last int64
+	for i := 0; i < 100; i++ {
+		if last, err = g.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the holder crashes without Close
+	allocator.Revoke(g.WorkerID())
+
+	c := &clock{}
+	g, err = idgen.New(ctx, allocator, idgen.WithClock(c.now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close(ctx)
+	if id, err := g.Next(); err == nil {
+		t.Fatalf("the reserved time of the crashed holder is reused by id %d", id)
+	} else if _, ok := err.(*idgen.ClockBackwardError); !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the ids are generated after the reserved time is passed
+	c.set(time.Second)
+	if id, err := g.Next(); err != nil || id <= last {
+		t.Errorf("id %d is not after %d: %v", id, last, err)
+	}
+}
+
+// failingAllocator leases the worker ids whose checkpoints fail after fail is set
+type failingAllocator struct {
+	*idgen.MemoryAllocator
+	fail int32
+}
+
+func (t *failingAllocator) Acquire(ctx context.Context) (idgen.Lease, error) {
+	l, err := t.MemoryAllocator.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &failingLease{Lease: l, allocator: t}, nil
+}
+
+type failingLease struct {
+	idgen.Lease
+	allocator *failingAllocator
+}
+
+func (t *failingLease) Checkpoint(ctx context.Context, mark time.Time) error {
+	if atomic.LoadInt32(&t.allocator.fail) == 1 {
+		return errors.New("unavailable")
+	}
+	return t.Lease.(idgen.Checkpointer).Checkpoint(ctx, mark)
+}
+
+func TestNotReserved(t *testing.T) {
+	ctx := context.Background()
+	allocator := &failingAllocator{MemoryAllocator: idgen.NewMemoryAllocator()}
+	g, err := idgen.New(ctx, allocator, idgen.WithReserve(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close(ctx)
+	if _, err := g.Next(); err != nil {
+		t.Fatal(err)
+	}
+	// the mark is kept ahead while the checkpoints succeed
+	time.Sleep(300 * time.Millisecond)
+	if _, err := g.Next(); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&allocator.fail, 1)
+	time.Sleep(300 * time.Millisecond)
+	if _, err := g.Next(); err != idgen.ErrNotReserved {
+		t.Errorf("expect not reserved, got %v", err)
+	}
+
+	// the generator is not created if the mark is not saved
+	if _, err := idgen.New(ctx, allocator); err == nil {
+		t.Error("expect the checkpoint error")
+	}
+}
@@ -0,0 +1,88 @@
+package idgen
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryAllocator leases the lowest free worker id in process
+type MemoryAllocator struct {
+	mu     sync.Mutex
+	leases map[int64]*memoryLease
+	// the last times reported by the released leases
+	last map[int64]time.Time
+}
+
+func NewMemoryAllocator() *MemoryAllocator {
+	return &MemoryAllocator{leases: make(map[int64]*memoryLease), last: make(map[int64]time.Time)}
+}
+
+func (t *MemoryAllocator) Acquire(ctx context.Context) (Lease, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := int64(0); id <= MaxWorkerID; id++ {
+		if _, ok := t.leases[id]; ok {
+			continue
+		}
+		l := &memoryLease{allocator: t, id: id, lastTime: t.last[id], done: make(chan struct{})}
+		t.leases[id] = l
+		return l, nil
+	}
+	return nil, ErrNoWorkerID
+}
+
+// Revoke makes the lease of the worker id lost,like the expiry of its session,the saved mark is kept
+func (t *MemoryAllocator) Revoke(id int64) {
+	t.mu.Lock()
+	l, ok := t.leases[id]
+	delete(t.leases, id)
+	t.mu.Unlock()
+	if ok {
+		l.once.Do(func() { close(l.done) })
+	}
+}
+
+type memoryLease struct {
+	allocator *MemoryAllocator
+	id        int64
+	lastTime  time.Time
+	done      chan struct{}
+	once      sync.Once
+}
+
+func (t *memoryLease) ID() int64 {
+	return t.id
+}
+
+func (t *memoryLease) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *memoryLease) LastTime() time.Time {
+	return t.lastTime
+}
+
+func (t *memoryLease) Release(ctx context.Context, last time.Time) error {
+	t.allocator.mu.Lock()
+	if t.allocator.leases[t.id] == t {
+		delete(t.allocator.leases, t.id)
+		if !last.IsZero() {
+			t.allocator.last[t.id] = last
+		}
+	}
+	t.allocator.mu.Unlock()
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
+
+// Checkpoint saves the mark as the last time of the worker id
+func (t *memoryLease) Checkpoint(ctx context.Context, mark time.Time) error {
+	t.allocator.mu.Lock()
+	defer t.allocator.mu.Unlock()
+	if t.allocator.leases[t.id] != t {
+		return ErrWorkerLost
+	}
+	t.allocator.last[t.id] = mark
+	return nil
+}